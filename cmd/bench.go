@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+// 未指定请求数和持续时间时默认发送的请求数
+const defaultBenchRequests = 200
+
+// 最多保留的延迟样本数, 超出后按蓄水池抽样替换, 长时间压测时内存占用不超过约8MB
+const benchMaxSamples = 1 << 20
+
+func BenchCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "bench",
+		Usage: "Load test an HTTP endpoint",
+		// 可重复的参数不按逗号拆分, 请求头中可能包含逗号
+		DisableSliceFlagSeparator: true,
+		Arguments: []cli.Argument{
+			&cli.StringArg{
+				Name: "url",
+			},
+		},
+		Flags: append([]cli.Flag{
+			&cli.IntFlag{
+				Name:    "requests",
+				Aliases: []string{"n"},
+				Usage:   "Number of requests to send (default 200 when --duration is not set)",
+			},
+			&cli.DurationFlag{
+				Name:    "duration",
+				Aliases: []string{"z"},
+				Usage:   "Keep sending requests for the duration, e.g. 30s",
+			},
+			&cli.Uint16Flag{
+				Name:    "concurrency",
+				Aliases: []string{"c"},
+				Value:   10,
+				Usage:   "Number of concurrent workers",
+			},
+			&cli.Float64Flag{
+				Name:  "rps",
+				Usage: "Send requests at a fixed rate (requests per second) instead of as fast as possible",
+			},
+			&cli.Uint8Flag{
+				Name:    "timeout",
+				Aliases: []string{"t"},
+				Value:   10,
+				Usage:   "Timeout in seconds for each request",
+			},
+		}, slices.Concat(requestFlags(), transportFlags(), authFlags())...),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			rawURL := c.StringArg("url")
+			if rawURL == "" {
+				return errors.New("url cannot be empty")
+			}
+
+			request, err := NewRequestFromFlags(c)
+			if err != nil {
+				return err
+			}
+			request.URL = rawURL
+
+			n := c.Int("requests")
+			duration := c.Duration("duration")
+			if n <= 0 && duration <= 0 {
+				n = defaultBenchRequests
+			}
+
+			var limiter *RateLimiter
+			if rps := c.Float64("rps"); rps > 0 {
+				limiter = NewRateLimiter(rps, 1)
+			}
+
+			transportOptions, err := NewTransportOptionsFromFlags(c)
+			if err != nil {
+				return err
+			}
+			transport, err := NewTransport(transportOptions)
+			if err != nil {
+				return err
+			}
+			defer transport.CloseIdleConnections()
+			roundTripper, err := ApplyAuthFlags(c, &request, transport)
+			if err != nil {
+				return err
+			}
+
+			// 中断时停止压测, 仍然输出已收集的结果
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			report := DoBench(ctx, BenchConfig{
+				Request:     request,
+				Requests:    n,
+				Duration:    duration,
+				Concurrency: c.Uint16("concurrency"),
+				CurlOptions: CurlOptions{
+					Timeout:   c.Uint8("timeout"),
+					Limiter:   limiter,
+					Transport: roundTripper,
+				},
+			})
+			if ctx.Err() != nil {
+				stop()
+				util.PrintErrorLog("Interrupted, showing results collected so far\n")
+			}
+			report.Print(os.Stdout)
+			return nil
+		},
+	}
+}
+
+// BenchConfig 压测参数, Requests 和 Duration 同时设置时以先达到者为准
+type BenchConfig struct {
+	Request     Request
+	Requests    int
+	Duration    time.Duration
+	Concurrency uint16
+	CurlOptions
+}
+
+// BenchReport 压测结果汇总
+// 响应数, 最快, 最慢和平均延迟按全部请求统计, 直方图和分位数基于 Latencies 中的样本计算
+type BenchReport struct {
+	Elapsed   time.Duration
+	Responses int
+	Fastest   time.Duration
+	Slowest   time.Duration
+	Total     time.Duration
+	// Latencies 是延迟样本, 请求数超过 benchMaxSamples 时为均匀抽样的结果
+	Latencies []time.Duration
+	Bytes     int64
+	Status    map[int]int
+	Errors    map[string]int
+}
+
+// DoBench 复用 DoCurlTask 的并发模型重复发送同一个请求
+func DoBench(ctx context.Context, cfg BenchConfig) *BenchReport {
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	task := Task{
+		Requests: func(yield func(Request) bool) {
+			for i := 0; cfg.Requests <= 0 || i < cfg.Requests; i++ {
+				if !yield(cfg.Request) {
+					return
+				}
+			}
+		},
+		Concurrency: cfg.Concurrency,
+		Quiet:       true,
+		CurlOptions: cfg.CurlOptions,
+	}
+
+	report := &BenchReport{Status: map[int]int{}, Errors: map[string]int{}}
+	start := time.Now()
+	for rst := range DoCurlTask(ctx, task) {
+		// 压测时间到达或被中断后取消的请求不计入结果
+		if rst.Err != nil && ctx.Err() != nil && (errors.Is(rst.Err, context.DeadlineExceeded) || errors.Is(rst.Err, context.Canceled)) {
+			continue
+		}
+		report.Add(rst)
+	}
+	report.Elapsed = time.Since(start)
+	return report
+}
+
+// Add 记录一个请求结果
+func (r *BenchReport) Add(rst TaskRst) {
+	if rst.Err != nil && rst.StatusCode == 0 {
+		r.Errors[benchErrorKey(rst.Err)]++
+		return
+	}
+	r.Status[rst.StatusCode]++
+	r.Bytes += rst.Size
+
+	d := rst.Duration
+	if r.Responses == 0 || d < r.Fastest {
+		r.Fastest = d
+	}
+	r.Slowest = max(r.Slowest, d)
+	r.Total += d
+	r.Responses++
+	if len(r.Latencies) < benchMaxSamples {
+		r.Latencies = append(r.Latencies, d)
+	} else if i := rand.IntN(r.Responses); i < benchMaxSamples {
+		r.Latencies[i] = d
+	}
+}
+
+// benchErrorKey 去掉错误信息中的请求方法和URL, 便于将同类错误归为一组
+func benchErrorKey(err error) string {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	return err.Error()
+}
+
+// Print 输出吞吐量, 延迟分布, 分位数, 状态码分布和错误统计
+func (r *BenchReport) Print(w io.Writer) {
+	total := r.Responses
+	errCount := 0
+	for _, n := range r.Errors {
+		errCount += n
+	}
+	seconds := r.Elapsed.Seconds()
+
+	latencies := slices.Clone(r.Latencies)
+	slices.Sort(latencies)
+
+	util.PrintToFile(w, "Summary:\n")
+	util.PrintToFile(w, "  Total:        %v\n", r.Elapsed.Round(time.Millisecond))
+	util.PrintToFile(w, "  Requests:     %d (%d responses, %d errors)\n", total+errCount, total, errCount)
+	util.PrintToFile(w, "  Requests/sec: %.2f\n", float64(total+errCount)/seconds)
+	util.PrintToFile(w, "  Transfer/sec: %s\n", formatBytes(float64(r.Bytes)/seconds))
+	if total > 0 {
+		util.PrintToFile(w, "  Fastest:      %v\n", roundMs(r.Fastest))
+		util.PrintToFile(w, "  Slowest:      %v\n", roundMs(r.Slowest))
+		util.PrintToFile(w, "  Average:      %v\n", roundMs(r.Total/time.Duration(total)))
+
+		util.PrintToFile(w, "\nLatency histogram:\n")
+		printHistogram(w, latencies)
+
+		util.PrintToFile(w, "\nLatency distribution:\n")
+		for _, p := range []float64{50, 75, 90, 95, 99, 99.9} {
+			util.PrintToFile(w, "  %5.1f%% in %v\n", p, roundMs(Percentile(latencies, p)))
+		}
+	}
+
+	if len(r.Status) > 0 {
+		util.PrintToFile(w, "\nStatus code distribution:\n")
+		codes := make([]int, 0, len(r.Status))
+		for code := range r.Status {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			util.PrintToFile(w, "  [%d] %d responses\n", code, r.Status[code])
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		util.PrintToFile(w, "\nError distribution:\n")
+		keys := make([]string, 0, len(r.Errors))
+		for k := range r.Errors {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return r.Errors[keys[i]] > r.Errors[keys[j]] })
+		for _, k := range keys {
+			util.PrintToFile(w, "  [%d] %s\n", r.Errors[k], k)
+		}
+	}
+}
+
+// printHistogram 将已排序的延迟均匀分为10个区间并绘制柱状图, 每行标注区间的上界
+func printHistogram(w io.Writer, sorted []time.Duration) {
+	const buckets = 10
+	const barWidth = 40
+
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+	width := (hi - lo) / buckets
+	counts := make([]int, buckets)
+	for _, d := range sorted {
+		idx := 0
+		if width > 0 {
+			// 区间宽度向下取整, 最大值附近的延迟归入最后一个区间
+			idx = min(int((d-lo)/width), buckets-1)
+		}
+		counts[idx]++
+	}
+	if width == 0 {
+		// 全部延迟相同时只输出一行
+		counts = counts[:1]
+	}
+	maxCount := slices.Max(counts)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	for i, n := range counts {
+		mark := lo + time.Duration(i+1)*width
+		if i == len(counts)-1 {
+			mark = hi
+		}
+		bar := strings.Repeat("■", n*barWidth/maxCount)
+		util.PrintToFile(tw, "  %v\t[%d]\t|%s\n", roundMs(mark), n, bar)
+	}
+	if err := tw.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+func formatBytes(b float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", b, units[i])
+}
@@ -2,11 +2,18 @@ package cmd
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/LiZeC123/gmh/util"
@@ -17,6 +24,8 @@ func CurlCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "curl",
 		Usage: "Send HTTP requests to one or multiple URLs",
+		// 可重复的参数不按逗号拆分, 请求头和断言中可能包含逗号
+		DisableSliceFlagSeparator: true,
 		Arguments: []cli.Argument{
 			&cli.StringArgs{
 				Name: "url",
@@ -24,12 +33,16 @@ func CurlCommand() *cli.Command {
 				Max:  -1,
 			},
 		},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:     "input",
 				Aliases:  []string{"i"},
 				Required: false,
-				Usage:    "Input file containing URLs (one per line). Use '-' for stdin",
+				Usage:    "Input file containing requests (one per line): URL, 'METHOD URL', JSON object or curl command. Use '-' for stdin",
+			},
+			&cli.StringFlag{
+				Name:  "from-curl",
+				Usage: "Run the request described by a curl command line, e.g. one copied from browser devtools",
 			},
 			&cli.BoolFlag{
 				Name:     "url-only",
@@ -50,6 +63,35 @@ func CurlCommand() *cli.Command {
 				Required: false,
 				Usage:    "Write results to the specified file",
 			},
+			&cli.StringFlag{
+				Name:  "state",
+				Usage: "Record finished requests to the file so an interrupted run can be resumed",
+			},
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Skip requests already finished in --state and append to --output",
+			},
+			&cli.StringFlag{
+				Name:  "download",
+				Usage: "Save each response body to a file under the directory instead of printing it",
+			},
+			&cli.StringFlag{
+				Name:  "name",
+				Value: defaultNameTemplate,
+				Usage: "File name template for --download: {index}, {host}, {path}, {base}, {ext}, {hash}. Names used by more than one URL get a -HASH suffix",
+			},
+			&cli.StringFlag{
+				Name:  "checksum",
+				Usage: "Expected checksum of downloaded files, e.g. sha256:HEX",
+			},
+			&cli.StringFlag{
+				Name:  "checksum-file",
+				Usage: "File in sha256sum format with expected checksums of downloaded files",
+			},
+			&cli.BoolFlag{
+				Name:  "ordered",
+				Usage: "Output results in input order instead of completion order",
+			},
 			&cli.BoolFlag{
 				Name:     "progress",
 				Aliases:  []string{"p"},
@@ -69,6 +111,23 @@ func CurlCommand() *cli.Command {
 				Value:   200,
 				Usage:   "Maximum number of concurrent requests",
 			},
+			&cli.StringFlag{
+				Name:  "rate",
+				Usage: "Limit request rate, e.g. 50/s or 600/m (token bucket)",
+			},
+			&cli.IntFlag{
+				Name:  "burst",
+				Value: 1,
+				Usage: "Maximum burst size allowed by --rate",
+			},
+			&cli.Uint16Flag{
+				Name:  "per-host",
+				Usage: "Maximum number of concurrent requests per host (0 means no limit)",
+			},
+			&cli.DurationFlag{
+				Name:  "deadline",
+				Usage: "Stop the whole run after the duration, e.g. 30s or 5m",
+			},
 			&cli.Uint8Flag{
 				Name:    "timeout",
 				Aliases: []string{"t"},
@@ -81,22 +140,65 @@ func CurlCommand() *cli.Command {
 				Value:   0,
 				Usage:   "Number of times to retry failed requests",
 			},
-		},
+			&cli.StringFlag{
+				Name:  "retry-on",
+				Value: "network,timeout,429,5xx",
+				Usage: "Conditions to retry on: network, timeout and status codes like 429 or 5xx",
+			},
+			&cli.DurationFlag{
+				Name:  "retry-delay",
+				Value: 200 * time.Millisecond,
+				Usage: "Initial backoff before the first retry, doubled on each attempt",
+			},
+			&cli.DurationFlag{
+				Name:  "retry-max-delay",
+				Value: 30 * time.Second,
+				Usage: "Upper bound of a single backoff, also caps Retry-After",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"F"},
+				Value:   "text",
+				Usage:   "Output format: text, json, jsonl, csv or table",
+			},
+			&cli.StringFlag{
+				Name:    "expect",
+				Aliases: []string{"e"},
+				Value:   "2xx,3xx",
+				Usage:   "Status codes treated as success, e.g. '2xx,304'. Not applied when a status assertion is given unless set explicitly",
+			},
+			&cli.BoolFlag{
+				Name:  "timing",
+				Usage: "Show DNS/connect/TLS/TTFB/transfer breakdown per URL and percentiles at the end",
+			},
+			&cli.StringSliceFlag{
+				Name:    "assert",
+				Aliases: []string{"A"},
+				Usage:   "Assertion on each response, e.g. 'status == 200', 'body contains ok', '$.code == 0', 'time < 500ms'. Status assertions replace the default --expect",
+			},
+			&cli.StringFlag{
+				Name:  "assert-file",
+				Usage: "File with one assertion per line ('#' starts a comment)",
+			},
+			&cli.BoolFlag{
+				Name:  "show-cert",
+				Usage: "Show the peer certificate chain (subject, SANs, issuer, expiry) of each URL",
+			},
+		}, slices.Concat(requestFlags(), transportFlags(), redirectFlags(), authFlags(), cookieFlags(), compareFlags(), harFlags(), bodyFlags(), crawlFlags(), streamFlags())...),
 		Action: func(ctx context.Context, c *cli.Command) error {
-			// 准备输入
-			urls, err := util.GetAllInput(c, "url", "input")
-			if err != nil {
-				return err
-			}
-			if len(urls) == 0 {
-				return fmt.Errorf("no URLs provided. Use command arguments, --input, or stdin")
-			}
-
 			// 准备输出
+			resume := c.Bool("resume")
+			if resume && c.String("state") == "" {
+				return fmt.Errorf("--resume requires --state")
+			}
 			outputFile := c.String("output")
 			var writer io.Writer = os.Stdout
 			if outputFile != "" {
-				f, err := os.Create(outputFile)
+				flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+				if resume {
+					flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+				}
+				f, err := os.OpenFile(outputFile, flag, 0644)
 				if err != nil {
 					return err
 				}
@@ -105,6 +207,21 @@ func CurlCommand() *cli.Command {
 			}
 			showProgress := c.Bool("progress") && outputFile != ""
 			step := int(c.Uint16("step"))
+			showTiming := c.Bool("timing")
+			binary, err := ParseBinaryMode(c.String("binary"))
+			if err != nil {
+				return err
+			}
+			rw, err := NewResultWriter(c.String("format"), writer, OutputOptions{
+				UrlOnly:   c.Bool("url-only"),
+				Timing:    showTiming,
+				ShowCert:  c.Bool("show-cert"),
+				Redirects: c.Bool("show-redirects"),
+				Body:      BodyRender{Pretty: c.Bool("pretty"), Binary: binary},
+			})
+			if err != nil {
+				return err
+			}
 
 			// 输出参数处理
 			filter := c.String("filter")
@@ -119,41 +236,339 @@ func CurlCommand() *cli.Command {
 				return fmt.Errorf("invalid filter value: %s. Use (a)ll, (s)uccess, or (f)ailure", filter)
 			}
 
+			// 比较模式下每个路径展开为两个请求, 比较结果替代普通输出
+			comparer, err := NewComparerFromFlags(c, writer)
+			if err != nil {
+				return err
+			}
+			if comparer != nil {
+				rw = comparer
+				filter = "all"
+			}
+
+			// 请求参数处理
+			template, err := NewRequestFromFlags(c)
+			if err != nil {
+				return err
+			}
+			var state *StateFile
+			if statePath := c.String("state"); statePath != "" {
+				state, err = OpenStateFile(statePath, resume)
+				if err != nil {
+					return err
+				}
+				defer util.CloseWithLog(state)
+				if resume {
+					util.PrintErrorLog("Resume from %s: %d requests already finished\n", statePath, state.Count())
+				}
+			}
+
+			var har *HarWriter
+			if harPath := c.String("har"); harPath != "" {
+				har, err = NewHarWriter(harPath, c.Bool("url-only"))
+				if err != nil {
+					return err
+				}
+				defer util.CloseWithLog(har)
+			}
+
+			var downloader *Downloader
+			if dir := c.String("download"); dir != "" {
+				downloader = NewDownloader(dir, c.String("name"))
+				if file := c.String("checksum-file"); file != "" {
+					if err := downloader.LoadChecksumFile(file); err != nil {
+						return err
+					}
+				}
+				template.Checksum = c.String("checksum")
+			}
+
+			// 结构化格式在结束时输出结果, 流式数据输出到标准错误以免破坏格式
+			streamWriter := writer
+			if format := c.String("format"); format != "" && format != "text" {
+				streamWriter = os.Stderr
+			}
+			streamer := NewStreamerFromFlags(c, streamWriter)
+			if streamer != nil && (downloader != nil || comparer != nil || c.Bool("crawl")) {
+				return fmt.Errorf("--stream cannot be used with --download, --compare or --crawl")
+			}
+
+			// 准备输入, 边读取边执行, 不会将整个输入读入内存
+			var total atomic.Int64
+			var inputErr error
+			var inputs iter.Seq[Request] = func(yield func(Request) bool) {
+				for request, err := range readRequests(c, template) {
+					if err != nil {
+						inputErr = err
+						return
+					}
+					batch := []Request{request}
+					if comparer != nil {
+						a, b := comparer.Expand(request)
+						batch = []Request{a, b}
+					}
+					for _, request := range batch {
+						if downloader != nil {
+							// 按输入顺序分配文件名, 跳过已完成的请求时也分配, 保证续传时文件名不变
+							downloader.AssignFileName(request)
+						}
+						if state != nil && state.Done(request) {
+							continue
+						}
+						if !yield(request) {
+							return
+						}
+					}
+				}
+			}
+			expect, err := ParseStatusMatcher(c.String("expect"))
+			if err != nil {
+				return err
+			}
+			assertExprs := c.StringSlice("assert")
+			if assertFile := c.String("assert-file"); assertFile != "" {
+				lines, err := util.GetFileInput(assertFile)
+				if err != nil {
+					return err
+				}
+				assertExprs = append(assertExprs, lines...)
+			}
+			assertions, err := ParseAssertions(assertExprs)
+			if err != nil {
+				return err
+			}
+			// 断言中指定了状态码时由断言决定是否成功, 否则 'status == 404' 永远无法通过默认的 --expect
+			if assertions.HasStatus() && !c.IsSet("expect") {
+				expect = nil
+			}
+
+			retry := RetryPolicy{
+				Max:       c.Uint8("retry"),
+				BaseDelay: c.Duration("retry-delay"),
+				MaxDelay:  c.Duration("retry-max-delay"),
+			}
+			if err := ParseRetryConditions(c.String("retry-on"), &retry); err != nil {
+				return err
+			}
+			if reconnect := c.Uint8("reconnect"); reconnect > 0 {
+				// 流中断后的重连通过重试实现, 总是处理网络错误, 读取超时和事件流的正常关闭
+				retry.Max = max(retry.Max, reconnect)
+				retry.OnNetwork = true
+				retry.OnTimeout = true
+				retry.OnStreamEnd = true
+			}
+
+			var limiter *RateLimiter
+			if rate := c.String("rate"); rate != "" {
+				r, err := ParseRate(rate)
+				if err != nil {
+					return err
+				}
+				limiter = NewRateLimiter(r, c.Int("burst"))
+			}
+			var hostLimiter *HostLimiter
+			if perHost := c.Uint16("per-host"); perHost > 0 {
+				hostLimiter = NewHostLimiter(int(perHost))
+			}
+			if deadline := c.Duration("deadline"); deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, deadline)
+				defer cancel()
+			}
+
+			// 第一次中断时停止发起新请求并等待进行中的请求完成, 第二次中断时立即取消
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			interrupt := make(chan struct{})
+			signals := make(chan os.Signal, 2)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(signals)
+			go func() {
+				select {
+				case <-signals:
+				case <-ctx.Done():
+					return
+				}
+				util.PrintErrorLog("Interrupted, waiting for in-flight requests. Press Ctrl-C again to abort\n")
+				close(interrupt)
+				select {
+				case <-signals:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			charset, err := ParseCharset(c.String("charset"))
+			if err != nil {
+				return err
+			}
+			transportOptions, err := NewTransportOptionsFromFlags(c)
+			if err != nil {
+				return err
+			}
+			transport, err := NewTransport(transportOptions)
+			if err != nil {
+				return err
+			}
+			defer transport.CloseIdleConnections()
+			roundTripper, err := ApplyAuthFlags(c, &template, transport)
+			if err != nil {
+				return err
+			}
+			jar, err := NewCookieJarFromFlags(c, &template)
+			if err != nil {
+				return err
+			}
+
+			options := CurlOptions{
+				Timeout:    c.Uint8("timeout"),
+				Retry:      retry,
+				Limiter:    limiter,
+				Transport:  roundTripper,
+				Redirect:   NewRedirectPolicyFromFlags(c),
+				Compressed: c.Bool("compressed"),
+				Charset:    charset,
+			}
+			if streamer != nil {
+				options.Stream = true
+				options.IdleTimeout = c.Duration("idle-timeout")
+			}
+			if jar != nil {
+				options.Jar = jar
+			}
+
+			crawler, err := NewCrawlerFromFlags(c, template, options)
+			if err != nil {
+				return err
+			}
+			if crawler != nil {
+				inputs = crawler.Crawl(ctx, interrupt, inputs)
+			}
+			requests := func(yield func(Request) bool) {
+				for request := range inputs {
+					total.Add(1)
+					if !yield(request) {
+						return
+					}
+				}
+			}
+
 			// 执行并发检测
 			task := Task{
-				Urls:        urls,
+				Requests:    requests,
 				Concurrency: c.Uint16("concurrency"),
-				Timeout:     c.Uint8("timeout"),
-				Retry:       c.Uint8("retry"),
 				UrlOnly:     c.Bool("url-only"),
+				Expect:      expect,
+				Assertions:  assertions,
+				HostLimiter: hostLimiter,
+				Interrupt:   interrupt,
+				Ordered:     c.Bool("ordered"),
+				Quiet:       comparer != nil,
+				CurlOptions: options,
+			}
+			if c.Bool("session") {
+				// 会话模式下依次执行请求, 使后续请求能够使用之前请求设置的Cookie
+				task.Concurrency = 1
+				task.Ordered = true
 			}
-			out := DoCurlTask(task)
+			if crawler != nil {
+				task.Visit = crawler.Visit
+			}
+			if streamer != nil {
+				task.Body = streamer
+			}
+			if downloader != nil {
+				task.Body = downloader
+				if c.Bool("progress") {
+					stop := downloader.ShowProgress(os.Stderr, time.Second)
+					defer stop()
+				}
+			}
+			out := DoCurlTask(ctx, task)
 
 			// 收集执行结果
-			total := len(task.Urls)
 			count := 0
 			succCount := 0
 			failCount := 0
+			var stats TimingStats
+			var assertSummary AssertionSummary
 			for rst := range out {
 				count++
+				// 被 --deadline 或第二次中断取消的请求没有完成, 不记录到状态文件, --resume 时重新发送
+				if state != nil && (rst.Err == nil || ctx.Err() == nil) {
+					state.Record(rst)
+				}
+				if har != nil {
+					har.Write(rst)
+				}
+				if showTiming {
+					stats.Add(rst)
+				}
+				assertSummary.Add(rst)
 				if rst.Err == nil {
 					succCount++
 					if filter == "success" {
-						util.PrintToFile(writer, "%s\n", rst.Data)
+						rw.Write(rst)
 					}
 				} else {
 					failCount++
 					if filter == "failure" {
-						util.PrintToFile(writer, "%s\n", rst.Data)
+						rw.Write(rst)
 					}
 				}
 
 				if filter == "all" {
-					util.PrintToFile(writer, "%s\n", rst.Data)
+					rw.Write(rst)
 				}
 
 				if showProgress && count%step == 0 {
-					fmt.Printf("Total %d Done %d (%.2f%%): Succ: %d Fail: %d (%.2f%%)\n", total, count, 100*float32(count)/float32(total), succCount, failCount, 100*float32(succCount)/float32(total))
+					read := total.Load()
+					fmt.Printf("Total %d Done %d (%.2f%%): Succ: %d Fail: %d (%.2f%%)\n", read, count, 100*float32(count)/float32(read), succCount, failCount, 100*float32(succCount)/float32(read))
+				}
+			}
+			rw.Flush()
+			if file := c.String("cookie-jar"); file != "" {
+				if err := jar.Save(file); err != nil {
+					return fmt.Errorf("failed to save cookie jar: %w", err)
+				}
+			}
+			if inputErr != nil {
+				return inputErr
+			}
+			if total.Load() == 0 && (state == nil || state.Count() == 0) {
+				return fmt.Errorf("no URLs provided. Use command arguments, --input, or stdin")
+			}
+
+			if showTiming {
+				stats.Print(os.Stderr)
+			}
+			if total := int(total.Load()); count < total {
+				reason := "interrupted"
+				if err := context.Cause(ctx); err != nil {
+					reason = err.Error()
+				}
+				util.PrintErrorLog("Run stopped (%s): Total %d Done %d Succ: %d Fail: %d Not started: %d\n",
+					reason, total, count, succCount, failCount, total-count)
+			}
+			if streamer != nil {
+				streamer.Print(os.Stderr)
+			}
+			if crawler != nil {
+				crawler.Print(os.Stderr)
+				if crawler.Broken() > 0 {
+					return fmt.Errorf("found %d broken links", crawler.Broken())
+				}
+			}
+			if comparer != nil {
+				comparer.Print(os.Stderr)
+				if comparer.Mismatches() > 0 {
+					return fmt.Errorf("%d paths differ between %s and %s", comparer.Mismatches(), comparer.BaseA, comparer.BaseB)
+				}
+			}
+			if len(assertions) > 0 {
+				assertSummary.Print(os.Stderr)
+				if assertSummary.Failed() > 0 {
+					return fmt.Errorf("%d of %d requests failed", assertSummary.Failed(), count)
 				}
 			}
 			return nil
@@ -161,82 +576,425 @@ func CurlCommand() *cli.Command {
 	}
 }
 
+// Task 描述一批并发执行的请求, Requests 可以是无限序列, 由ctx控制结束
 type Task struct {
-	Urls        []string
+	Requests    iter.Seq[Request]
 	Concurrency uint16
-	Timeout     uint8
-	Retry       uint8
 	UrlOnly     bool
+	Expect      StatusMatcher
+	// Assertions 在状态码符合 Expect 后检查, 任一断言失败则请求失败, Expect 为nil时不检查状态码
+	Assertions  Assertions
+	HostLimiter *HostLimiter
+	// Interrupt 关闭后不再发起新的请求, 但进行中的请求会继续执行完
+	Interrupt <-chan struct{}
+	// Ordered 按输入顺序输出结果
+	Ordered bool
+	// Quiet 不在标准错误输出每个失败请求的详情
+	Quiet bool
+	// Visit 在请求完成后, 输出结果前调用, 会被多个worker并发调用
+	Visit func(request Request, rst TaskRst)
+	CurlOptions
 }
 
+// CurlOptions 是单个请求的执行参数
+type CurlOptions struct {
+	Timeout uint8
+	Retry   RetryPolicy
+	// Limiter 限制请求的发送速率, DoCurl 只在重试前等待, 首次发送由调用方等待
+	Limiter *RateLimiter
+	// Transport 在所有请求间共享以复用连接, 为空时使用默认Transport
+	Transport http.RoundTripper
+	// Redirect 控制重定向的跟随方式, 为空时使用默认策略
+	Redirect *RedirectPolicy
+	// Jar 在请求间共享Cookie, 为空时不保存Cookie
+	Jar http.CookieJar
+	// Compressed 为true时请求压缩的响应, 响应体总是按Content-Encoding解压
+	Compressed bool
+	// Charset 是文本响应体的字符集, 为空或auto时自动判断, 读取到 TaskRst.Data 时转换为UTF-8
+	Charset string
+	// Stream 为true时不限制请求的总时间, Timeout只限制等待响应头的时间
+	Stream bool
+	// IdleTimeout 是Stream模式下两次收到数据的最大间隔, 0表示不限制
+	IdleTimeout time.Duration
+	// Body 处理响应体, 为空时将响应体读取到 TaskRst.Data
+	Body BodyHandler
+}
+
+// BodyHandler 自定义请求的发送和响应体的处理方式
+type BodyHandler interface {
+	// Prepare 在每次发送前调整请求, 例如添加Range头
+	Prepare(request Request, req *http.Request) error
+	// Consume 读取响应体并填充结果
+	Consume(request Request, resp *http.Response, rst *TaskRst) error
+}
+
+// TaskRst 记录一次请求的执行结果, 状态码不符合预期时Err不为空
+// 重试时 Duration 和 Timing 均为最后一次尝试的耗时
 type TaskRst struct {
+	Index      int
+	URL        string
+	Method     string
+	Proto      string
+	FinalURL   string
+	StatusCode int
+	Header     http.Header
+	Size       int64
+	Retries    int
+	Duration   time.Duration
+	Timing     *Timing
+	Certs      []*x509.Certificate
+	Redirects  []RedirectHop
+	// Stream 是流式模式下的接收统计
+	Stream *StreamStats
+	// Start, RequestHeader 和 RequestBody 记录实际发出的请求, 用于导出HAR
+	Start         time.Time
+	RequestHeader http.Header
+	RequestBody   []byte
+	// File 是下载模式下保存响应体的文件
+	File string
 	Data string
 	Err  error
 }
 
-func DoCurlTask(task Task) (out chan TaskRst) {
+// seqResult 是带有分发序号的结果, ok为false表示请求未发出
+type seqResult struct {
+	seq int
+	rst TaskRst
+	ok  bool
+}
+
+// DoCurlTask 并发执行所有请求, ctx结束后不再发起新的请求, 进行中的请求也会被取消
+// Ordered 为true时按请求的分发顺序输出结果, 否则按完成顺序输出
+func DoCurlTask(ctx context.Context, task Task) (out chan TaskRst) {
 	out = make(chan TaskRst, 10)
 	sem := make(chan struct{}, task.Concurrency)
 	var wg sync.WaitGroup
 
+	// queue 限制已分发但尚未完成的请求数, 按Host限流时请求先等待Host名额, 不占用全局并发名额
+	// 以免同一Host的请求占满全部并发, 其他Host的请求只能等待
+	queueSize := int(task.Concurrency)
+	if task.HostLimiter != nil {
+		queueSize = max(4*int(task.Concurrency), 1)
+	}
+	queue := make(chan struct{}, queueSize)
+
+	// 有序输出时, 已分发但尚未输出的请求数不超过window, 以限制重排缓冲区的大小
+	var pending chan seqResult
+	var window chan struct{}
+	if task.Ordered {
+		pending = make(chan seqResult, 10)
+		window = make(chan struct{}, max(4*int(task.Concurrency), 1))
+		go reorderResults(pending, window, out)
+	}
+	emit := func(seq int, rst TaskRst, ok bool) {
+		if task.Ordered {
+			pending <- seqResult{seq, rst, ok}
+		} else if ok {
+			out <- rst
+		}
+	}
+
+	// dispatchCtx 只控制请求能否发出, 中断时进行中的请求不受影响
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
 	go func() {
-		defer close(out)
+		select {
+		case <-task.Interrupt:
+		case <-dispatchCtx.Done():
+		}
+		stopDispatch()
+	}()
 
-		for _, url := range task.Urls {
-			sem <- struct{}{}
+	go func() {
+		defer func() {
+			wg.Wait()
+			stopDispatch()
+			if task.Ordered {
+				close(pending)
+			} else {
+				close(out)
+			}
+		}()
+
+		seq := 0
+		for request := range task.Requests {
+			if task.Ordered {
+				select {
+				case window <- struct{}{}:
+				case <-dispatchCtx.Done():
+					return
+				}
+			}
+			select {
+			case queue <- struct{}{}:
+			case <-dispatchCtx.Done():
+				if task.Ordered {
+					<-window
+				}
+				return
+			}
 			wg.Add(1)
 
-			go func(u string) {
+			go func(seq int, r Request) {
 				defer func() {
-					<-sem
+					<-queue
 					wg.Done()
 				}()
 
-				data, err := DoCurl(url, task.Timeout, task.Retry)
+				// 先取得Host名额再占用全局名额, 停止发起请求前未发出的请求不输出结果
+				release, err := task.HostLimiter.Acquire(dispatchCtx, hostOf(r.URL))
+				if err != nil {
+					emit(seq, TaskRst{}, false)
+					return
+				}
+				select {
+				case sem <- struct{}{}:
+				case <-dispatchCtx.Done():
+					release()
+					emit(seq, TaskRst{}, false)
+					return
+				}
+				defer func() { <-sem }()
+				if err := task.Limiter.Wait(dispatchCtx); err != nil {
+					release()
+					emit(seq, TaskRst{}, false)
+					return
+				}
+				rst := DoCurl(ctx, r, task.CurlOptions)
+				release()
+				if rst.Err == nil && task.Expect != nil && !task.Expect.Match(rst.StatusCode) {
+					rst.Err = fmt.Errorf("unexpected status: %d", rst.StatusCode)
+				}
+				if rst.Err == nil && len(task.Assertions) > 0 {
+					rst.Err = task.Assertions.Check(rst)
+				}
 
+				if task.Visit != nil {
+					task.Visit(r, rst)
+				}
 				if task.UrlOnly {
-					data = url
+					rst.Data = r.URL
 				}
 
 				// 详细的错误信息输出到标准错误, 可重定向到文件
-				if err != nil {
-					util.PrintErrorLog("Curl %s failed with err: %v\n", url, err)
+				if rst.Err != nil && !task.Quiet {
+					util.PrintErrorLog("Curl %s failed with err: %v\n", r.URL, rst.Err)
 				}
 
-				out <- TaskRst{
-					Data: data,
-					Err:  err,
-				}
-			}(url)
+				emit(seq, rst, true)
+			}(seq, request)
+			seq++
 		}
-		wg.Wait()
 	}()
 
 	return out
+}
 
+// reorderResults 按序号重排结果后写入out, 每输出一个序号释放一个window名额
+func reorderResults(pending <-chan seqResult, window <-chan struct{}, out chan<- TaskRst) {
+	defer close(out)
+
+	buffer := map[int]seqResult{}
+	next := 0
+	for r := range pending {
+		buffer[r.seq] = r
+		for {
+			head, ok := buffer[next]
+			if !ok {
+				break
+			}
+			delete(buffer, next)
+			next++
+			<-window
+			if head.ok {
+				out <- head.rst
+			}
+		}
+	}
 }
 
-func DoCurl(url string, timeout uint8, retry uint8) (body string, err error) {
-	req, err := http.NewRequest("GET", url, nil)
+// DoCurl 执行一个请求, 按重试策略重试失败的请求
+func DoCurl(ctx context.Context, request Request, opts CurlOptions) (rst TaskRst) {
+	// 无法构造的请求不需要重试
+	if _, err := request.Build(); err != nil {
+		return TaskRst{Index: request.Index, URL: request.URL, Method: request.Method, Err: err}
+	}
+
+	for attempt := 0; ; attempt++ {
+		rst = doCurlOnce(ctx, request, opts)
+		rst.Retries = attempt
+		if attempt >= int(opts.Retry.Max) || ctx.Err() != nil || !opts.Retry.ShouldRetry(rst) {
+			return rst
+		}
+
+		wait := opts.Retry.Backoff(attempt, rst)
+		if rst.Err == nil && rst.Stream != nil && rst.Stream.Ended {
+			util.PrintErrorLog("Curl %s event stream closed by server, reconnect in %v\n", request.URL, wait.Round(time.Millisecond))
+		} else {
+			util.PrintErrorLog("Curl %s attempt %d failed (status=%d err=%v), retry in %v\n",
+				request.URL, attempt+1, rst.StatusCode, rst.Err, wait.Round(time.Millisecond))
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return rst
+		}
+		if err := opts.Limiter.Wait(ctx); err != nil {
+			return rst
+		}
+	}
+}
+
+func doCurlOnce(ctx context.Context, request Request, opts CurlOptions) (rst TaskRst) {
+	rst = TaskRst{Index: request.Index, URL: request.URL, Method: request.Method, RequestBody: request.Body}
+	rst.Start = time.Now()
+	defer func() {
+		rst.Duration = time.Since(rst.Start)
+	}()
+
+	req, err := request.Build()
 	if err != nil {
-		return "", err
+		rst.Err = err
+		return
+	}
+	rst.Method = req.Method
+	if opts.Body != nil {
+		if err := opts.Body.Prepare(request, req); err != nil {
+			rst.Err = err
+			return
+		}
 	}
 
-	// 覆盖默认标识，添加浏览器特征头
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	if opts.Compressed && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rst.RequestHeader = req.Header
+	timeout := time.Duration(opts.Timeout) * time.Second
+	var deadline *streamDeadline
+	if opts.Stream {
+		ctx, deadline = newStreamDeadline(ctx, timeout, opts.IdleTimeout)
+		defer func() { rst.Err = deadline.Stop(rst.Err) }()
+		timeout = 0
+	}
+	tracer := &timingTracer{}
+	req = req.WithContext(tracer.WithContext(ctx))
 
+	policy := opts.Redirect
+	if policy == nil {
+		policy = &defaultRedirectPolicy
+	}
+	redirects := newRedirectRecorder(*policy)
 	client := &http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
+		Transport:     opts.Transport,
+		CheckRedirect: redirects.CheckRedirect,
+		Jar:           opts.Jar,
+		Timeout:       timeout,
 	}
-
 	resp, err := client.Do(req)
+	rst.Redirects = redirects.hops
+	if resp != nil {
+		// 重定向失败时resp为最后一个3xx响应, 响应体已关闭
+		defer util.CloseWithLog(resp.Body)
+		rst.StatusCode = resp.StatusCode
+		rst.Proto = resp.Proto
+		rst.Header = resp.Header
+		rst.FinalURL = resp.Request.URL.String()
+		if resp.TLS != nil {
+			rst.Certs = resp.TLS.PeerCertificates
+		}
+	}
 	if err != nil {
-		return "", err
+		rst.Err = err
+		return
+	}
+	if deadline != nil {
+		resp.Body = deadline.Wrap(resp.Body)
+	}
+
+	if err := decodeContentEncoding(resp); err != nil {
+		rst.Err = err
+		return
+	}
+	if opts.Body != nil {
+		rst.Err = opts.Body.Consume(request, resp, &rst)
+		tracer.Done()
+		rst.Timing = tracer.Timing()
+		return
+	}
+
+	bytes, err := io.ReadAll(resp.Body)
+	tracer.Done()
+	rst.Timing = tracer.Timing()
+	rst.Size = int64(len(bytes))
+	rst.Err = err
+	// 无法识别的字符集保留原始内容
+	if text, err := decodeCharset(bytes, resp.Header.Get("Content-Type"), opts.Charset); err == nil {
+		bytes = text
 	}
-	defer util.CloseWithLog(resp.Body)
+	rst.Data = string(bytes)
+	return
+}
+
+// readRequests 按顺序读取全部输入请求
+// 指定 --from-har 或 --from-curl 时从HAR文件或curl命令读取, 否则逐行读取URL, 每行也可以是一个curl命令
+func readRequests(c *cli.Command, template Request) iter.Seq2[Request, error] {
+	return func(yield func(Request, error) bool) {
+		if harFile := c.String("from-har"); harFile != "" {
+			requests, err := ReadHarRequests(harFile, template)
+			if err != nil {
+				yield(Request{}, err)
+				return
+			}
+			for _, request := range requests {
+				if !yield(request, nil) {
+					return
+				}
+			}
+			return
+		}
 
-	bytes, _ := io.ReadAll(resp.Body)
-	return string(bytes), nil
+		if command := c.String("from-curl"); command != "" {
+			request, err := ParseCurlCommand(command, template)
+			if err != nil {
+				err = fmt.Errorf("invalid --from-curl: %w", err)
+			}
+			yield(request, err)
+			return
+		}
+
+		index := 0
+		pending := ""
+		// --compare 模式下第一个位置参数是 BASE_B, 不是请求
+		skipBase := c.String("compare") != ""
+		for line, err := range util.StreamAllInput(c, "url", "input") {
+			if err != nil {
+				yield(Request{}, err)
+				return
+			}
+			if skipBase {
+				skipBase = false
+				continue
+			}
+			// 从开发者工具复制的curl命令可能通过行尾的反斜杠分为多行
+			if pending != "" || IsCurlCommand(line) {
+				var done bool
+				if pending, done = joinCurlLines(pending, line); !done {
+					continue
+				}
+				line, pending = pending, ""
+			}
+			request := ParseRequestLineOrInvalid(line, template)
+			request.Index = index
+			index++
+			if !yield(request, nil) {
+				return
+			}
+		}
+	}
+}
+
+// hostOf 返回URL中的Host部分, 无法解析时返回原始字符串
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
 }
@@ -0,0 +1,423 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+)
+
+// Assertion 是针对单个响应的一条断言, 格式为 "<subject> <op> [operand]"
+//
+//	status == 200          status == 2xx,304
+//	header.Content-Type ~ json
+//	header.X-Trace exists
+//	body contains ok       body ~ "id":\s*\d+
+//	$.data.items[0].id == 42
+//	time < 500ms           size <= 1048576
+type Assertion struct {
+	Expr    string
+	subject string
+	op      string
+	operand string
+	re      *regexp.Regexp
+	status  StatusMatcher
+	path    []any
+}
+
+var assertOps = []string{"contains", "exists", "==", "!=", "!~", "<=", ">=", "~", "<", ">"}
+
+// ParseAssertion 解析一条断言表达式
+func ParseAssertion(expr string) (*Assertion, error) {
+	a := &Assertion{Expr: expr}
+	subject, op, operand, ok := splitAssertion(expr)
+	if !ok {
+		return nil, fmt.Errorf("invalid assertion %q, expect '<subject> <op> [value]'", expr)
+	}
+	a.subject, a.op, a.operand = subject, op, operand
+
+	if (op == "exists") != (operand == "") {
+		return nil, fmt.Errorf("invalid assertion %q: 'exists' takes no value, other operators need one", expr)
+	}
+
+	var err error
+	switch {
+	case subject == "status":
+		if op != "==" && op != "!=" {
+			return nil, fmt.Errorf("invalid assertion %q: status only supports == and !=", expr)
+		}
+		a.status, err = ParseStatusMatcher(operand)
+	case subject == "time":
+		if !isOrderOp(op) {
+			return nil, fmt.Errorf("invalid assertion %q: time only supports <, <=, > and >=", expr)
+		}
+		_, err = time.ParseDuration(operand)
+	case subject == "size":
+		if !isOrderOp(op) && op != "==" && op != "!=" {
+			return nil, fmt.Errorf("invalid assertion %q: size only supports comparison operators", expr)
+		}
+		_, err = strconv.ParseInt(operand, 10, 64)
+	case subject == "body", strings.HasPrefix(subject, "header."):
+		if isOrderOp(op) {
+			return nil, fmt.Errorf("invalid assertion %q: %s does not support %s", expr, subject, op)
+		}
+	case strings.HasPrefix(subject, "$"):
+		a.path, err = parseJSONPath(subject)
+	default:
+		return nil, fmt.Errorf("invalid assertion %q: unknown subject %q", expr, subject)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertion %q: %w", expr, err)
+	}
+
+	if op == "~" || op == "!~" {
+		if a.re, err = regexp.Compile(operand); err != nil {
+			return nil, fmt.Errorf("invalid assertion %q: %w", expr, err)
+		}
+	}
+	return a, nil
+}
+
+// splitAssertion 按第一个以空白分隔的操作符拆分表达式, 操作数保留原始的空白
+func splitAssertion(expr string) (subject, op, operand string, ok bool) {
+	pos := 0
+	for i, field := range strings.Fields(expr) {
+		start := pos + strings.Index(expr[pos:], field)
+		pos = start + len(field)
+		if i == 0 || !slices.Contains(assertOps, field) {
+			continue
+		}
+		subject = strings.TrimSpace(expr[:start])
+		operand = strings.TrimSpace(expr[pos:])
+		return subject, field, operand, true
+	}
+	return "", "", "", false
+}
+
+func isOrderOp(op string) bool {
+	return op == "<" || op == "<=" || op == ">" || op == ">="
+}
+
+// Check 检查响应是否满足断言, 不满足时返回原因
+func (a *Assertion) Check(rst TaskRst) error {
+	switch {
+	case a.subject == "status":
+		ok := a.status.Match(rst.StatusCode)
+		if ok != (a.op == "==") {
+			return fmt.Errorf("status is %d", rst.StatusCode)
+		}
+		return nil
+	case a.subject == "time":
+		limit, _ := time.ParseDuration(a.operand)
+		if !compareOrder(a.op, float64(rst.Duration), float64(limit)) {
+			return fmt.Errorf("time is %v", rst.Duration.Round(time.Millisecond))
+		}
+		return nil
+	case a.subject == "size":
+		limit, _ := strconv.ParseInt(a.operand, 10, 64)
+		ok := compareOrder(a.op, float64(rst.Size), float64(limit))
+		if a.op == "==" || a.op == "!=" {
+			ok = (rst.Size == limit) == (a.op == "==")
+		}
+		if !ok {
+			return fmt.Errorf("size is %d", rst.Size)
+		}
+		return nil
+	case a.subject == "body":
+		return a.checkString("body", rst.Data, true)
+	case strings.HasPrefix(a.subject, "header."):
+		name := strings.TrimPrefix(a.subject, "header.")
+		values, found := rst.Header[http.CanonicalHeaderKey(name)]
+		return a.checkString("header "+name, strings.Join(values, ", "), found)
+	default:
+		return a.checkJSON(rst.Data)
+	}
+}
+
+func (a *Assertion) checkString(what, value string, found bool) error {
+	var ok bool
+	switch a.op {
+	case "exists":
+		ok = found
+	case "==":
+		ok = found && value == a.operand
+	case "!=":
+		ok = !found || value != a.operand
+	case "contains":
+		ok = found && strings.Contains(value, a.operand)
+	case "~":
+		ok = found && a.re.MatchString(value)
+	case "!~":
+		ok = !found || !a.re.MatchString(value)
+	}
+	if ok {
+		return nil
+	}
+	if !found {
+		return fmt.Errorf("%s is missing", what)
+	}
+	return fmt.Errorf("%s is %q", what, truncate(value, 80))
+}
+
+func (a *Assertion) checkJSON(body string) error {
+	var doc any
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		return fmt.Errorf("body is not JSON: %v", err)
+	}
+
+	value, found := lookupJSONPath(doc, a.path)
+	if a.op == "exists" {
+		if !found {
+			return fmt.Errorf("%s is missing", a.subject)
+		}
+		return nil
+	}
+	if !found {
+		if a.op == "!=" || a.op == "!~" {
+			return nil
+		}
+		return fmt.Errorf("%s is missing", a.subject)
+	}
+
+	// 操作数能解析为JSON时按JSON值比较, 否则按字符串比较
+	var expect any
+	if err := json.Unmarshal([]byte(a.operand), &expect); err != nil {
+		expect = a.operand
+	}
+
+	var ok bool
+	switch a.op {
+	case "==":
+		ok = reflect.DeepEqual(value, expect)
+	case "!=":
+		ok = !reflect.DeepEqual(value, expect)
+	case "contains", "~", "!~":
+		s, isString := value.(string)
+		if !isString {
+			raw, _ := json.Marshal(value)
+			s = string(raw)
+		}
+		switch a.op {
+		case "contains":
+			ok = strings.Contains(s, a.operand)
+		case "~":
+			ok = a.re.MatchString(s)
+		default:
+			ok = !a.re.MatchString(s)
+		}
+	default:
+		v, isNum := value.(float64)
+		e, expectNum := expect.(float64)
+		ok = isNum && expectNum && compareOrder(a.op, v, e)
+	}
+
+	if !ok {
+		raw, _ := json.Marshal(value)
+		return fmt.Errorf("%s is %s", a.subject, truncate(string(raw), 80))
+	}
+	return nil
+}
+
+func compareOrder(op string, v, limit float64) bool {
+	switch op {
+	case "<":
+		return v < limit
+	case "<=":
+		return v <= limit
+	case ">":
+		return v > limit
+	case ">=":
+		return v >= limit
+	}
+	return false
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// parseJSONPath 解析 $.a.b[0]["c d"] 形式的路径, 返回由字段名和下标组成的序列
+func parseJSONPath(path string) ([]any, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("JSONPath must start with $")
+	}
+
+	var segments []any
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty field name in %q", path)
+			}
+			segments = append(segments, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']' in %q", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if idx, err := strconv.Atoi(inner); err == nil {
+				segments = append(segments, idx)
+			} else if unquoted, err := strconv.Unquote(strings.ReplaceAll(inner, "'", `"`)); err == nil {
+				segments = append(segments, unquoted)
+			} else {
+				return nil, fmt.Errorf("invalid index %q in %q", inner, path)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", rest[0], path)
+		}
+	}
+	return segments, nil
+}
+
+func lookupJSONPath(doc any, path []any) (any, bool) {
+	cur := doc
+	for _, seg := range path {
+		switch key := seg.(type) {
+		case string:
+			obj, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = obj[key]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := cur.([]any)
+			if !ok {
+				return nil, false
+			}
+			if key < 0 {
+				key += len(arr)
+			}
+			if key < 0 || key >= len(arr) {
+				return nil, false
+			}
+			cur = arr[key]
+		}
+	}
+	return cur, true
+}
+
+// Assertions 是同时作用于每个响应的一组断言
+type Assertions []*Assertion
+
+// ParseAssertions 解析多条断言表达式
+func ParseAssertions(exprs []string) (Assertions, error) {
+	var as Assertions
+	for _, expr := range exprs {
+		expr = strings.TrimSpace(expr)
+		if expr == "" || strings.HasPrefix(expr, "#") {
+			continue
+		}
+		a, err := ParseAssertion(expr)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+// HasStatus 判断是否包含状态码断言
+func (as Assertions) HasStatus() bool {
+	return slices.ContainsFunc(as, func(a *Assertion) bool { return a.subject == "status" })
+}
+
+// AssertionError 记录一个响应未通过的全部断言
+type AssertionError struct {
+	Failures []AssertionFailure
+}
+
+// AssertionFailure 是一条未通过的断言及其原因
+type AssertionFailure struct {
+	Assertion *Assertion
+	Reason    error
+}
+
+func (e *AssertionError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("assert '%s' failed: %v", f.Assertion.Expr, f.Reason))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Check 依次检查所有断言, 返回 *AssertionError 或 nil
+func (as Assertions) Check(rst TaskRst) error {
+	var failures []AssertionFailure
+	for _, a := range as {
+		if err := a.Check(rst); err != nil {
+			failures = append(failures, AssertionFailure{a, err})
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &AssertionError{Failures: failures}
+}
+
+// AssertionSummary 统计每条断言的失败次数
+type AssertionSummary struct {
+	total, failed int
+	counts        map[string]int
+}
+
+// Add 记录一个请求结果
+func (s *AssertionSummary) Add(rst TaskRst) {
+	s.total++
+	if rst.Err == nil {
+		return
+	}
+	s.failed++
+	if s.counts == nil {
+		s.counts = map[string]int{}
+	}
+	var ae *AssertionError
+	if !errors.As(rst.Err, &ae) {
+		s.counts["(request error)"]++
+		return
+	}
+	for _, f := range ae.Failures {
+		s.counts[f.Assertion.Expr]++
+	}
+}
+
+// Failed 返回未通过检查的请求数
+func (s *AssertionSummary) Failed() int {
+	return s.failed
+}
+
+// Print 输出断言检查的汇总信息
+func (s *AssertionSummary) Print(w io.Writer) {
+	util.PrintToFile(w, "Assertions: %d requests, %d passed, %d failed\n", s.total, s.total-s.failed, s.failed)
+	keys := make([]string, 0, len(s.counts))
+	for k := range s.counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.counts[keys[i]] > s.counts[keys[j]] })
+	for _, k := range keys {
+		util.PrintToFile(w, "  [%d] %s\n", s.counts[k], k)
+	}
+}
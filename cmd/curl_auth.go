@@ -0,0 +1,484 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+func authFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "user",
+			Aliases: []string{"U"},
+			Usage:   "Credentials in user:password form, sent as Basic auth (or Digest with --digest)",
+		},
+		&cli.BoolFlag{
+			Name:  "digest",
+			Usage: "Use HTTP Digest authentication with --user",
+		},
+		&cli.StringFlag{
+			Name:  "bearer",
+			Usage: "Bearer token sent in the Authorization header",
+		},
+		&cli.StringFlag{
+			Name:  "bearer-file",
+			Usage: "Read the bearer token from the file",
+		},
+		&cli.StringFlag{
+			Name:  "aws-sigv4",
+			Usage: "Sign requests with AWS Signature V4 for the service (e.g. execute-api, s3), credentials from AWS_* env",
+		},
+		&cli.StringFlag{
+			Name:    "aws-region",
+			Sources: cli.EnvVars("AWS_REGION", "AWS_DEFAULT_REGION"),
+			Usage:   "AWS region used by --aws-sigv4",
+		},
+	}
+}
+
+// ApplyAuthFlags 根据命令行参数设置认证, Basic和Bearer直接写入请求模板,
+// Digest和SigV4需要针对每个请求计算, 通过包装Transport实现
+func ApplyAuthFlags(c *cli.Command, template *Request, transport http.RoundTripper) (http.RoundTripper, error) {
+	token := c.String("bearer")
+	if file := c.String("bearer-file"); file != "" {
+		if token != "" {
+			return nil, fmt.Errorf("--bearer and --bearer-file cannot be used together")
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	credential := c.String("user")
+	var user, password string
+	if credential != "" {
+		var ok bool
+		user, password, ok = strings.Cut(credential, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid --user %q, expect user:password", credential)
+		}
+	}
+
+	service := c.String("aws-sigv4")
+	methods := 0
+	for _, set := range []bool{token != "", credential != "", service != ""} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return nil, fmt.Errorf("only one of --user, --bearer/--bearer-file and --aws-sigv4 can be used")
+	}
+	if c.Bool("digest") && credential == "" {
+		return nil, fmt.Errorf("--digest requires --user")
+	}
+
+	switch {
+	case token != "":
+		template.Header.Set("Authorization", "Bearer "+token)
+	case credential != "" && c.Bool("digest"):
+		return &DigestTransport{Base: transport, User: user, Password: password}, nil
+	case credential != "":
+		template.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credential)))
+	case service != "":
+		signer, err := NewSigV4FromEnv(c.String("aws-region"), service)
+		if err != nil {
+			return nil, err
+		}
+		return &SigV4Transport{Base: transport, Signer: signer}, nil
+	}
+	return transport, nil
+}
+
+// DigestTransport 处理服务端的Digest认证质询, 并对同一Host的后续请求直接附带认证信息
+type DigestTransport struct {
+	Base     http.RoundTripper
+	User     string
+	Password string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// digestChallenge 是服务端在 WWW-Authenticate 中给出的质询参数
+type digestChallenge struct {
+	realm, nonce, opaque, algorithm, qop string
+	count                                int
+}
+
+func (t *DigestTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *DigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth, ok := t.authorize(req); ok {
+		req = withHeader(req, "Authorization", auth)
+	}
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge, err := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	if challenge == nil {
+		return resp, nil
+	}
+	// 需要重新发送请求体, 无法重放时直接返回401
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	t.mu.Lock()
+	if t.challenges == nil {
+		t.challenges = map[string]*digestChallenge{}
+	}
+	t.challenges[req.URL.Host] = challenge
+	t.mu.Unlock()
+
+	auth, _ := t.authorize(req)
+	retry := withHeader(req, "Authorization", auth)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return t.base().RoundTrip(retry)
+}
+
+// authorize 使用已缓存的质询生成 Authorization 头
+func (t *DigestTransport) authorize(req *http.Request) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch, ok := t.challenges[req.URL.Host]
+	if !ok {
+		return "", false
+	}
+	ch.count++
+
+	newHash := md5.New
+	algorithm := strings.ToUpper(ch.algorithm)
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		return hashHex(newHash(), []byte(s))
+	}
+
+	uri := req.URL.RequestURI()
+	nc := fmt.Sprintf("%08x", ch.count)
+	cnonce := randomHex(8)
+	ha1 := h(t.User + ":" + ch.realm + ":" + t.Password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + ch.nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	var response string
+	if ch.qop == "" {
+		response = h(ha1 + ":" + ch.nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + ch.nonce + ":" + nc + ":" + cnonce + ":" + ch.qop + ":" + ha2)
+	}
+
+	parts := []string{
+		fmt.Sprintf(`username="%s"`, t.User),
+		fmt.Sprintf(`realm="%s"`, ch.realm),
+		fmt.Sprintf(`nonce="%s"`, ch.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if ch.algorithm != "" {
+		parts = append(parts, "algorithm="+ch.algorithm)
+	}
+	if ch.qop != "" {
+		parts = append(parts, "qop="+ch.qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	if ch.opaque != "" {
+		parts = append(parts, fmt.Sprintf(`opaque="%s"`, ch.opaque))
+	}
+	return "Digest " + strings.Join(parts, ", "), true
+}
+
+// parseDigestChallenge 从多个 WWW-Authenticate 头中找到Digest质询
+// 只支持qop=auth, 服务端只提供auth-int等其他qop时返回错误, 不能退回到不带qop的RFC 2069方式
+func parseDigestChallenge(values []string) (*digestChallenge, error) {
+	for _, v := range values {
+		rest, ok := cutPrefixFold(strings.TrimSpace(v), "Digest ")
+		if !ok {
+			continue
+		}
+		params := parseAuthParams(rest)
+		ch := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		}
+		// 服务端支持多种qop时优先使用auth
+		for _, q := range strings.Split(params["qop"], ",") {
+			if strings.TrimSpace(q) == "auth" {
+				ch.qop = "auth"
+			}
+		}
+		if ch.qop == "" && strings.TrimSpace(params["qop"]) != "" {
+			return nil, fmt.Errorf("unsupported digest qop %q, only auth is supported", params["qop"])
+		}
+		return ch, nil
+	}
+	return nil, nil
+}
+
+// parseAuthParams 解析 key=value 或 key="value" 形式的逗号分隔参数
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s != "" {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			value = strings.ReplaceAll(rest[1:min(end, len(rest))], `\"`, `"`)
+			rest = rest[min(end+1, len(rest)):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+		s = rest
+	}
+	return params
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
+
+// withHeader 复制请求并设置请求头, RoundTripper不能修改传入的请求
+func withHeader(req *http.Request, name, value string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set(name, value)
+	return r
+}
+
+func hashHex(h hash.Hash, data []byte) string {
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SigV4 使用 AWS Signature Version 4 对请求签名
+type SigV4 struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Region       string
+	Service      string
+}
+
+// NewSigV4FromEnv 从 AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN 读取凭证
+func NewSigV4FromEnv(region, service string) (*SigV4, error) {
+	s := &SigV4{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Region:       region,
+		Service:      service,
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("--aws-sigv4 requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if s.Region == "" {
+		return nil, fmt.Errorf("--aws-sigv4 requires --aws-region or AWS_REGION")
+	}
+	return s, nil
+}
+
+// Sign 计算签名并设置 Authorization 等请求头, body为请求体的完整内容
+func (s *SigV4) Sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := hashHex(sha256.New(), body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.Join(trimAll(values), ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// 规范URI按RFC 3986对解码后的路径逐段编码, 除S3外其他服务要求再编码一次
+	segments := strings.Split(req.URL.Path, "/")
+	for i, seg := range segments {
+		seg = sigV4Escape(seg)
+		if s.Service != "s3" {
+			seg = sigV4Escape(seg)
+		}
+		segments[i] = seg
+	}
+	path := strings.Join(segments, "/")
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.Region, s.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex(sha256.New(), []byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, s.Region, s.Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func trimAll(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return out
+}
+
+// canonicalQuery 按键和值排序并使用RFC 3986编码查询参数
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for key, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, sigV4Escape(key)+"="+sigV4Escape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func sigV4Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// SigV4Transport 在发送前对每个请求签名, 重定向后的请求会重新签名
+type SigV4Transport struct {
+	Base   http.RoundTripper
+	Signer *SigV4
+}
+
+func (t *SigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("cannot sign request with a non-replayable body")
+		}
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	signed := req.Clone(req.Context())
+	if req.Body != nil {
+		_ = req.Body.Close()
+		signed.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	t.Signer.Sign(signed, body, time.Now())
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(signed)
+}
@@ -0,0 +1,340 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+func bodyFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "compressed",
+			Usage: "Request a compressed response (gzip, deflate, br, zstd) and decompress it",
+		},
+		&cli.StringFlag{
+			Name:  "charset",
+			Value: "auto",
+			Usage: "Charset of text bodies: 'auto' uses Content-Type or <meta>, a name (e.g. gbk) forces it, 'raw' keeps the bytes",
+		},
+		&cli.BoolFlag{
+			Name:  "pretty",
+			Usage: "Pretty-print JSON and XML bodies",
+		},
+		&cli.StringFlag{
+			Name:  "binary",
+			Value: "summary",
+			Usage: "Output of binary bodies: summary (type and size), hex (hexdump of the first 512 bytes) or raw",
+		},
+	}
+}
+
+// acceptEncoding 是 --compressed 时声明支持的压缩方式
+const acceptEncoding = "gzip, deflate, br, zstd"
+
+// hasResponseBody 判断响应是否可能有响应体, HEAD, 204, 304 和空响应体即使带有Content-Encoding也无需解压
+func hasResponseBody(resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return false
+	}
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	return resp.ContentLength != 0
+}
+
+// decodeContentEncoding 按Content-Encoding解压响应体, 多重编码时按相反的顺序解压
+// Transport自动处理gzip时会删除该响应头, 此时不做处理
+func decodeContentEncoding(resp *http.Response) error {
+	if !hasResponseBody(resp) {
+		return nil
+	}
+	encodings := strings.Split(resp.Header.Get("Content-Encoding"), ",")
+	body := resp.Body
+	var closers []io.Closer
+	decoded := false
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var r io.Reader
+		var err error
+		switch enc := strings.ToLower(strings.TrimSpace(encodings[i])); enc {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(body)
+		case "deflate":
+			r, err = newDeflateReader(body)
+		case "br":
+			r = brotli.NewReader(body)
+		case "zstd":
+			var d *zstd.Decoder
+			if d, err = zstd.NewReader(body); err == nil {
+				r = d.IOReadCloser()
+			}
+		default:
+			return fmt.Errorf("unsupported Content-Encoding: %s", enc)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode %s body: %w", encodings[i], err)
+		}
+		decoded = true
+		if c, ok := r.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+		body = struct {
+			io.Reader
+			io.Closer
+		}{r, body}
+	}
+
+	if decoded {
+		resp.Body = &decodedBody{ReadCloser: body, closers: closers}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return nil
+}
+
+// newDeflateReader 兼容zlib格式和部分服务器返回的原始deflate格式
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	buf := bufioPeeker{r: r}
+	head, err := buf.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	// zlib头部的两个字节按大端序组成的数字是31的倍数
+	if len(head) == 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(&buf)
+	}
+	return flate.NewReader(&buf), nil
+}
+
+// bufioPeeker 支持预读少量字节后继续读取
+type bufioPeeker struct {
+	r    io.Reader
+	head []byte
+}
+
+func (p *bufioPeeker) Peek(n int) ([]byte, error) {
+	for len(p.head) < n {
+		b := make([]byte, n-len(p.head))
+		m, err := p.r.Read(b)
+		p.head = append(p.head, b[:m]...)
+		if err != nil {
+			return p.head, err
+		}
+	}
+	return p.head, nil
+}
+
+func (p *bufioPeeker) Read(b []byte) (int, error) {
+	if len(p.head) > 0 {
+		n := copy(b, p.head)
+		p.head = p.head[n:]
+		return n, nil
+	}
+	return p.r.Read(b)
+}
+
+// decodedBody 关闭时同时关闭解压器和原始响应体
+type decodedBody struct {
+	io.ReadCloser
+	closers []io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	for _, c := range d.closers {
+		_ = c.Close()
+	}
+	return d.ReadCloser.Close()
+}
+
+var metaCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([\w-]+)|<\?xml[^>]+encoding\s*=\s*["']([\w-]+)`)
+
+// detectCharset 按 BOM, Content-Type, HTML的meta标签或XML声明的顺序判断文本的字符集
+func detectCharset(data []byte, contentType string) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8"
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		return params["charset"]
+	}
+	head := data[:min(len(data), 1024)]
+	if m := metaCharsetPattern.FindSubmatch(head); m != nil {
+		return string(append(m[1], m[2]...))
+	}
+	return ""
+}
+
+// decodeCharset 将文本响应体转换为UTF-8, charset为auto时自动判断, 为raw时不转换
+func decodeCharset(data []byte, contentType, charset string) ([]byte, error) {
+	if charset == "raw" || !isTextContent(data, contentType) {
+		return data, nil
+	}
+	if charset == "auto" || charset == "" {
+		charset = detectCharset(data, contentType)
+		if charset == "" {
+			return data, nil
+		}
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return data, fmt.Errorf("unknown charset %q", charset)
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF}), nil
+	}
+	return enc.NewDecoder().Bytes(data)
+}
+
+// ParseCharset 检查 --charset 指定的字符集是否可用
+func ParseCharset(charset string) (string, error) {
+	if charset == "" || charset == "auto" || charset == "raw" {
+		return charset, nil
+	}
+	if _, err := htmlindex.Get(charset); err != nil {
+		return "", fmt.Errorf("invalid charset value: %s", charset)
+	}
+	return charset, nil
+}
+
+// textContentTypes 是按文本处理的非 text/* 类型
+var textContentTypes = []string{"json", "xml", "javascript", "ecmascript", "x-www-form-urlencoded", "yaml", "toml", "csv", "graphql"}
+
+// isTextContent 根据Content-Type判断响应体是否为文本, 没有Content-Type时根据内容判断
+func isTextContent(data []byte, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, t := range textContentTypes {
+		if strings.Contains(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// BodyRender 控制输出时响应体的展示方式
+type BodyRender struct {
+	Pretty bool
+	// Binary 为 summary, hex 或 raw
+	Binary string
+}
+
+// maxHexDump 是hex模式下最多输出的字节数
+const maxHexDump = 512
+
+func ParseBinaryMode(mode string) (string, error) {
+	switch mode {
+	case "summary", "hex", "raw":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid binary value: %s. Use summary, hex or raw", mode)
+	}
+}
+
+// Render 返回用于输出的响应体, 二进制内容按Binary模式展示, 文本内容按需格式化
+func (b BodyRender) Render(rst TaskRst) string {
+	data := rst.Data
+	contentType := rst.Header.Get("Content-Type")
+	if data == "" {
+		return data
+	}
+
+	if !isTextContent([]byte(data), contentType) && !utf8.ValidString(data) {
+		switch b.Binary {
+		case "hex":
+			dump := hex.Dump([]byte(data[:min(len(data), maxHexDump)]))
+			if len(data) > maxHexDump {
+				dump += fmt.Sprintf("... %d more bytes\n", len(data)-maxHexDump)
+			}
+			return strings.TrimSuffix(dump, "\n")
+		case "raw":
+			return data
+		default:
+			if contentType == "" {
+				contentType = http.DetectContentType([]byte(data))
+			}
+			return fmt.Sprintf("[binary body: %s, %d bytes]", contentType, len(data))
+		}
+	}
+
+	if b.Pretty {
+		return prettyBody(data, contentType)
+	}
+	return data
+}
+
+// prettyBody 格式化JSON和XML, 无法解析时原样返回
+func prettyBody(data, contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	trimmed := strings.TrimSpace(data)
+	switch {
+	case strings.Contains(mediaType, "json") || json.Valid([]byte(trimmed)):
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, []byte(trimmed), "", "  "); err == nil {
+			return buf.String()
+		}
+	case strings.Contains(mediaType, "xml") || strings.HasPrefix(trimmed, "<?xml"):
+		if pretty, err := indentXML(trimmed); err == nil {
+			return pretty
+		}
+	}
+	return data
+}
+
+// indentXML 重新编码XML的每个token以添加缩进, 会去掉原有的空白文本
+func indentXML(data string) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(data))
+	dec.Strict = false
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if cd, ok := tok.(xml.CharData); ok && len(bytes.TrimSpace(cd)) == 0 {
+			continue
+		}
+		if err := enc.EncodeToken(xml.CopyToken(tok)); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+)
+
+// certInfo 是证书中便于排查问题的关键字段
+type certInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	SANs      []string  `json:"sans,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	DaysLeft  int       `json:"days_left"`
+}
+
+func newCertInfos(certs []*x509.Certificate) []certInfo {
+	infos := make([]certInfo, 0, len(certs))
+	for _, cert := range certs {
+		infos = append(infos, certInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			SANs:      certSANs(cert),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			DaysLeft:  int(time.Until(cert.NotAfter).Hours() / 24),
+		})
+	}
+	return infos
+}
+
+// certSANs 汇总证书中的DNS名称和IP地址
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+// printCertChain 按服务端返回的顺序输出证书链, 第一个为叶子证书
+func printCertChain(w io.Writer, certs []*x509.Certificate) {
+	if len(certs) == 0 {
+		util.PrintToFile(w, "  (no peer certificate)\n")
+		return
+	}
+
+	for i, info := range newCertInfos(certs) {
+		util.PrintToFile(w, "  [%d] Subject: %s\n", i, info.Subject)
+		if len(info.SANs) > 0 {
+			util.PrintToFile(w, "      SANs:    %s\n", strings.Join(info.SANs, ", "))
+		}
+		util.PrintToFile(w, "      Issuer:  %s\n", info.Issuer)
+		util.PrintToFile(w, "      Valid:   %s - %s (%d days left)\n",
+			info.NotBefore.Format(time.DateOnly), info.NotAfter.Format(time.DateOnly), info.DaysLeft)
+	}
+}
@@ -0,0 +1,416 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// curlNoArgOptions 是解析时忽略的无参数curl选项, 它们只影响curl自身的输出或由gmh的参数控制
+var curlNoArgOptions = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true,
+	"-L": true, "--location": true, "-k": true, "--insecure": true,
+	"-i": true, "--include": true, "-v": true, "--verbose": true,
+	"-g": true, "--globoff": true, "-f": true, "--fail": true,
+	"-N": true, "--no-buffer": true, "-#": true, "--progress-bar": true,
+	"--http1.1": true, "--http2": true, "--http2-prior-knowledge": true,
+	"--no-keepalive": true, "--path-as-is": true, "-O": true, "--remote-name": true,
+}
+
+// curlArgOptions 是解析时忽略的带参数curl选项
+var curlArgOptions = map[string]bool{
+	"-o": true, "--output": true, "-m": true, "--max-time": true,
+	"--connect-timeout": true, "--retry": true, "--retry-delay": true, "--max-redirs": true,
+	"-w": true, "--write-out": true, "-c": true, "--cookie-jar": true,
+	"--resolve": true, "--connect-to": true, "-x": true, "--proxy": true,
+	"--cacert": true, "-E": true, "--cert": true, "--key": true,
+}
+
+// curlShortArgs 是需要参数的单字母选项, 用于拆分 -XPOST 和 -sSL 这类写法
+const curlShortArgs = "XHdbuAeFToxmwcE"
+
+// IsCurlCommand 判断一行输入是否是curl命令
+func IsCurlCommand(line string) bool {
+	return line == "curl" || strings.HasPrefix(line, "curl ") || strings.HasPrefix(line, "curl\t")
+}
+
+// ParseCurlCommand 将浏览器开发者工具中复制的curl命令转换为请求
+// 支持 -X, -H, -d/--data-raw/--data-binary/--data-urlencode, --json, -F, -G, -I, -T, -u, -b, -A, -e 等常用选项
+func ParseCurlCommand(command string, template Request) (req Request, err error) {
+	args, err := splitShellWords(command)
+	if err != nil {
+		return req, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return req, fmt.Errorf("not a curl command: %q", command)
+	}
+	args = expandShortOptions(args[1:])
+
+	req = template.Clone()
+	var method string
+	var data []string
+	var form *multipart.Writer
+	var formBody bytes.Buffer
+	get, head := false, false
+	// curl中同名请求头会全部发送, 但需要覆盖模板中的同名请求头
+	seen := map[string]bool{}
+	setHeader := func(name, value string) {
+		name = http.CanonicalHeaderKey(name)
+		if seen[name] {
+			req.Header.Add(name, value)
+		} else {
+			req.Header.Set(name, value)
+			seen[name] = true
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("curl option %s requires a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			req.URL = arg
+			continue
+		}
+		if curlNoArgOptions[arg] {
+			continue
+		}
+		if arg == "--compressed" {
+			if req.Header.Get("Accept-Encoding") == "" {
+				setHeader("Accept-Encoding", acceptEncoding)
+			}
+			continue
+		}
+
+		var v string
+		if !(arg == "-G" || arg == "--get" || arg == "-I" || arg == "--head") {
+			if v, err = value(); err != nil {
+				return req, err
+			}
+		}
+		switch arg {
+		case "--url":
+			req.URL = v
+		case "-X", "--request":
+			method = strings.ToUpper(v)
+		case "-H", "--header":
+			name, val, err := ParseHeader(v)
+			if err != nil {
+				return req, err
+			}
+			setHeader(name, val)
+		case "-d", "--data", "--data-ascii", "--data-binary":
+			if strings.HasPrefix(v, "@") {
+				body, err := readBody(v)
+				if err != nil {
+					return req, err
+				}
+				v = string(body)
+				if arg != "--data-binary" {
+					v = strings.NewReplacer("\r", "", "\n", "").Replace(v)
+				}
+			}
+			data = append(data, v)
+		case "--data-raw":
+			data = append(data, v)
+		case "--data-urlencode":
+			encoded, err := curlURLEncode(v)
+			if err != nil {
+				return req, err
+			}
+			data = append(data, encoded)
+		case "--json":
+			data = append(data, v)
+			setHeader("Content-Type", "application/json")
+			setHeader("Accept", "application/json")
+		case "-F", "--form":
+			if form == nil {
+				form = multipart.NewWriter(&formBody)
+			}
+			if err := addFormField(form, v); err != nil {
+				return req, err
+			}
+		case "-T", "--upload-file":
+			body, err := os.ReadFile(v)
+			if err != nil {
+				return req, err
+			}
+			req.Body = body
+			if method == "" {
+				method = http.MethodPut
+			}
+		case "-G", "--get":
+			get = true
+		case "-I", "--head":
+			head = true
+		case "-u", "--user":
+			setHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(v)))
+		case "-b", "--cookie":
+			if !strings.Contains(v, "=") {
+				return req, fmt.Errorf("curl option %s with a cookie file is not supported, use --cookie", arg)
+			}
+			setHeader("Cookie", v)
+		case "-A", "--user-agent":
+			setHeader("User-Agent", v)
+		case "-e", "--referer":
+			setHeader("Referer", v)
+		default:
+			if !curlArgOptions[arg] {
+				return req, fmt.Errorf("unsupported curl option %s", arg)
+			}
+		}
+	}
+
+	if req.URL == "" {
+		return req, fmt.Errorf("no URL in curl command")
+	}
+	if !strings.Contains(req.URL, "://") {
+		req.URL = "http://" + req.URL
+	}
+
+	switch {
+	case form != nil:
+		if err := form.Close(); err != nil {
+			return req, err
+		}
+		req.Body = formBody.Bytes()
+		setHeader("Content-Type", form.FormDataContentType())
+	case len(data) > 0 && get:
+		sep := "?"
+		if strings.Contains(req.URL, "?") {
+			sep = "&"
+		}
+		req.URL += sep + strings.Join(data, "&")
+	case len(data) > 0:
+		req.Body = []byte(strings.Join(data, "&"))
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+
+	switch {
+	case method != "":
+		req.Method = method
+	case head:
+		req.Method = http.MethodHead
+	case get:
+		req.Method = http.MethodGet
+	case req.Body != nil && req.Method == http.MethodGet:
+		req.Method = http.MethodPost
+	}
+	return req, nil
+}
+
+// expandShortOptions 拆分合并的短选项, 例如 -sSL 拆分为 -s -S -L, -XPOST 拆分为 -X POST
+func expandShortOptions(args []string) []string {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		if len(arg) <= 2 || arg[0] != '-' || arg[1] == '-' {
+			expanded = append(expanded, arg)
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			opt := "-" + arg[j:j+1]
+			expanded = append(expanded, opt)
+			if strings.IndexByte(curlShortArgs, arg[j]) >= 0 {
+				if j+1 < len(arg) {
+					expanded = append(expanded, arg[j+1:])
+				}
+				break
+			}
+		}
+	}
+	return expanded
+}
+
+// curlURLEncode 实现 --data-urlencode 的 content, name=content, @file 和 name@file 写法
+func curlURLEncode(v string) (string, error) {
+	name, content, ok := strings.Cut(v, "=")
+	if !ok {
+		var file string
+		if name, file, ok = strings.Cut(v, "@"); ok {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return "", err
+			}
+			content = string(data)
+		} else {
+			name, content = "", v
+		}
+	}
+	if name == "" {
+		return url.QueryEscape(content), nil
+	}
+	return name + "=" + url.QueryEscape(content), nil
+}
+
+// addFormField 添加 -F 指定的字段, name=value 为普通字段, name=<file 读取文件内容, name=@file 为上传文件
+func addFormField(form *multipart.Writer, field string) error {
+	name, value, ok := strings.Cut(field, "=")
+	if !ok {
+		return fmt.Errorf("invalid form field %q, expect name=value", field)
+	}
+	if file, ok := strings.CutPrefix(value, "<"); ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return form.WriteField(name, string(data))
+	}
+	file, isFile := strings.CutPrefix(value, "@")
+	if !isFile {
+		return form.WriteField(name, value)
+	}
+
+	// 去掉 ;type=xxx 这类附加参数
+	file, _, _ = strings.Cut(file, ";")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	w, err := form.CreateFormFile(name, filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// splitShellWords 按照POSIX shell的规则拆分命令行
+// 支持单引号, 双引号, $'...' 和反斜杠转义, 反斜杠加换行视为续行
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		case ch == '\\':
+			if i+1 < len(s) {
+				i++
+				if s[i] == '\n' {
+					continue
+				}
+				if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+					i++
+					continue
+				}
+				cur.WriteByte(s[i])
+				inWord = true
+			}
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, err := readANSIQuoted(s[i+2:], &cur)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 1
+			inWord = true
+		case ch == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				// 双引号中只有 \ " $ ` 和换行可以被转义
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				cur.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		default:
+			cur.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// readANSIQuoted 读取 $'...' 中的内容, 返回消耗的字节数(包含结尾的单引号)
+func readANSIQuoted(s string, out *strings.Builder) (int, error) {
+	escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"', 'a': '\a', 'b': '\b', 'e': 0x1b, 'f': '\f', 'v': '\v'}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return 0, fmt.Errorf("unterminated $'...' quote")
+			}
+			i++
+			if b, ok := escapes[s[i]]; ok {
+				out.WriteByte(b)
+				continue
+			}
+			size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+			if size == 0 {
+				out.WriteByte('\\')
+				out.WriteByte(s[i])
+				continue
+			}
+			// \x 后最多2位, \u 后最多4位, \U 后最多8位十六进制数
+			j := i + 1
+			for j < len(s) && j < i+1+size && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			code, err := strconv.ParseUint(s[i+1:j], 16, 32)
+			if err != nil {
+				return 0, fmt.Errorf("invalid escape \\%s in $'...' quote", s[i:j])
+			}
+			if s[i] == 'x' {
+				out.WriteByte(byte(code))
+			} else {
+				out.WriteRune(rune(code))
+			}
+			i = j - 1
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+	return 0, fmt.Errorf("unterminated $'...' quote")
+}
+
+// joinCurlLines 将以反斜杠结尾的curl命令行与后续行合并, ok为false表示命令尚未结束
+func joinCurlLines(pending, line string) (command string, ok bool) {
+	if pending != "" {
+		line = pending + "\n" + line
+	}
+	if strings.HasSuffix(line, "\\") {
+		return line, false
+	}
+	return line, true
+}
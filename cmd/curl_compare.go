@@ -0,0 +1,423 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+func compareFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "compare",
+			Usage: "Run each path against two base URLs and report differences: --compare BASE_A BASE_B PATH..., the first argument is BASE_B",
+		},
+		&cli.StringSliceFlag{
+			Name:  "compare-header",
+			Usage: "Response header also compared in --compare mode",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ignore",
+			Usage: "Ignore rule for --compare: a JSONPath ($.ts, $.items[*].id, $..requestId) or a regexp removed from non-JSON bodies",
+		},
+	}
+}
+
+// maxReportedDiffs 是每个路径最多输出的差异数量
+const maxReportedDiffs = 20
+
+// Comparer 将同一请求在两个环境上的结果配对并比较
+// 输入的第i个请求展开为序号 2i 和 2i+1 的两个请求, 分别发往 BaseA 和 BaseB
+type Comparer struct {
+	BaseA, BaseB string
+	Headers      []string
+	Ignore       IgnoreRules
+
+	w       io.Writer
+	jsonl   bool
+	pending map[int]TaskRst
+	same    int
+	diff    int
+}
+
+// NewComparerFromFlags 根据命令行参数创建Comparer, 未开启比较模式时返回nil
+// BASE_A 是 --compare 的值, BASE_B 是第一个位置参数, 其余参数和 --input 中的每一行是待比较的路径
+func NewComparerFromFlags(c *cli.Command, w io.Writer) (*Comparer, error) {
+	baseA := c.String("compare")
+	if baseA == "" {
+		return nil, nil
+	}
+	args := c.StringArgs("url")
+	if len(args) == 0 {
+		return nil, fmt.Errorf("--compare requires two base URLs. Usage: gmh curl --compare BASE_A BASE_B [PATH...]")
+	}
+	bases := []string{baseA, args[0]}
+	if c.String("download") != "" {
+		return nil, fmt.Errorf("--compare cannot be used with --download")
+	}
+	// --url-only 会将响应体替换为URL, 两个环境的结果总是不同
+	if c.Bool("url-only") {
+		return nil, fmt.Errorf("--compare cannot be used with --url-only")
+	}
+
+	cp := &Comparer{
+		BaseA:   strings.TrimSuffix(bases[0], "/"),
+		BaseB:   strings.TrimSuffix(bases[1], "/"),
+		Headers: c.StringSlice("compare-header"),
+		w:       w,
+		pending: map[int]TaskRst{},
+	}
+	switch format := c.String("format"); format {
+	case "", "text":
+	case "jsonl":
+		cp.jsonl = true
+	default:
+		return nil, fmt.Errorf("invalid format value for --compare: %s. Use text or jsonl", format)
+	}
+
+	var err error
+	if cp.Ignore, err = ParseIgnoreRules(c.StringSlice("ignore")); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Expand 将一个请求展开为分别发往两个环境的请求
+// 输入可以是路径, 也可以是完整URL, 此时只保留路径和查询参数
+func (cp *Comparer) Expand(r Request) (a, b Request) {
+	path := r.URL
+	if u, err := url.Parse(r.URL); err == nil && u.Host != "" {
+		path = u.RequestURI()
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	a, b = r.Clone(), r.Clone()
+	a.Index, b.Index = 2*r.Index, 2*r.Index+1
+	a.URL, b.URL = cp.BaseA+path, cp.BaseB+path
+	return a, b
+}
+
+// comparison 是一对结果的比较结果
+type comparison struct {
+	Index  int      `json:"index"`
+	Method string   `json:"method"`
+	Path   string   `json:"path"`
+	URLA   string   `json:"url_a"`
+	URLB   string   `json:"url_b"`
+	Same   bool     `json:"same"`
+	Diffs  []string `json:"diffs,omitempty"`
+}
+
+// Write 添加一个结果, 同一路径的两个结果都到达后进行比较并输出
+// Comparer 实现了 ResultWriter, 比较模式下替代普通的结果输出
+func (cp *Comparer) Write(rst TaskRst) {
+	pair := rst.Index / 2
+	other, ok := cp.pending[pair]
+	if !ok {
+		cp.pending[pair] = rst
+		return
+	}
+	delete(cp.pending, pair)
+
+	a, b := other, rst
+	if a.Index > b.Index {
+		a, b = b, a
+	}
+	cmp := comparison{
+		Index:  pair,
+		Method: a.Method,
+		Path:   strings.TrimPrefix(a.URL, cp.BaseA),
+		URLA:   a.URL,
+		URLB:   b.URL,
+		Diffs:  cp.Compare(a, b),
+	}
+	cmp.Same = len(cmp.Diffs) == 0
+	if cmp.Same {
+		cp.same++
+	} else {
+		cp.diff++
+	}
+	cp.write(cmp)
+}
+
+func (cp *Comparer) Flush() {}
+
+func (cp *Comparer) write(cmp comparison) {
+	if cp.jsonl {
+		data, err := json.Marshal(cmp)
+		if err != nil {
+			panic(err)
+		}
+		util.PrintToFile(cp.w, "%s\n", data)
+		return
+	}
+
+	// 文本格式只输出存在差异的路径
+	if cmp.Same {
+		return
+	}
+	util.PrintToFile(cp.w, "[%d] %s %s\n", cmp.Index, cmp.Method, cmp.Path)
+	for _, d := range cmp.Diffs {
+		util.PrintToFile(cp.w, "  %s\n", d)
+	}
+}
+
+// Compare 比较状态码, 指定的响应头和响应体, 返回差异描述
+func (cp *Comparer) Compare(a, b TaskRst) []string {
+	var diffs []string
+	// 没有响应时只能比较错误信息
+	if a.StatusCode == 0 || b.StatusCode == 0 {
+		if a.StatusCode != b.StatusCode || a.Err != nil || b.Err != nil {
+			diffs = append(diffs, fmt.Sprintf("error: %s != %s", errorText(a), errorText(b)))
+		}
+		return diffs
+	}
+
+	if a.StatusCode != b.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("status: %d != %d", a.StatusCode, b.StatusCode))
+	}
+	for _, name := range cp.Headers {
+		va, vb := a.Header.Values(name), b.Header.Values(name)
+		if !slices.Equal(va, vb) {
+			diffs = append(diffs, fmt.Sprintf("header %s: %q != %q",
+				http.CanonicalHeaderKey(name), strings.Join(va, ", "), strings.Join(vb, ", ")))
+		}
+	}
+
+	bodyDiffs := cp.compareBody(a.Data, b.Data)
+	if len(bodyDiffs) > maxReportedDiffs {
+		more := len(bodyDiffs) - maxReportedDiffs
+		bodyDiffs = append(bodyDiffs[:maxReportedDiffs], fmt.Sprintf("... %d more body differences", more))
+	}
+	return append(diffs, bodyDiffs...)
+}
+
+func errorText(rst TaskRst) string {
+	if rst.Err == nil {
+		return strconv.Itoa(rst.StatusCode)
+	}
+	return rst.Err.Error()
+}
+
+// compareBody 两侧都是JSON时逐字段比较, 否则去除忽略的内容后按行比较
+func (cp *Comparer) compareBody(a, b string) []string {
+	var docA, docB any
+	if json.Unmarshal([]byte(a), &docA) == nil && json.Unmarshal([]byte(b), &docB) == nil {
+		var diffs []string
+		cp.diffJSON([]string{"$"}, docA, docB, &diffs)
+		return diffs
+	}
+
+	a, b = cp.Ignore.Strip(a), cp.Ignore.Strip(b)
+	if a == b {
+		return nil
+	}
+	linesA, linesB := strings.Split(a, "\n"), strings.Split(b, "\n")
+	for i := range max(len(linesA), len(linesB)) {
+		la, lb := lineAt(linesA, i), lineAt(linesB, i)
+		if la != lb {
+			return []string{fmt.Sprintf("body line %d: %q != %q (size %d != %d)", i+1, la, lb, len(a), len(b))}
+		}
+	}
+	return nil
+}
+
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// diffJSON 递归比较两个JSON值, path 是当前值的路径分段
+func (cp *Comparer) diffJSON(path []string, a, b any, diffs *[]string) {
+	if cp.Ignore.Match(path) {
+		return
+	}
+
+	switch va := a.(type) {
+	case map[string]any:
+		if vb, ok := b.(map[string]any); ok {
+			keys := make([]string, 0, len(va)+len(vb))
+			for k := range va {
+				keys = append(keys, k)
+			}
+			for k := range vb {
+				if _, ok := va[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				child := append(slices.Clip(path), k)
+				ca, okA := va[k]
+				cb, okB := vb[k]
+				switch {
+				case !okA && !cp.Ignore.Match(child):
+					*diffs = append(*diffs, fmt.Sprintf("body %s: missing != %s", joinJSONPath(child), jsonText(cb)))
+				case !okB && !cp.Ignore.Match(child):
+					*diffs = append(*diffs, fmt.Sprintf("body %s: %s != missing", joinJSONPath(child), jsonText(ca)))
+				case okA && okB:
+					cp.diffJSON(child, ca, cb, diffs)
+				}
+			}
+			return
+		}
+	case []any:
+		if vb, ok := b.([]any); ok {
+			for i := range max(len(va), len(vb)) {
+				child := append(slices.Clip(path), "["+strconv.Itoa(i)+"]")
+				switch {
+				case cp.Ignore.Match(child):
+				case i >= len(va):
+					*diffs = append(*diffs, fmt.Sprintf("body %s: missing != %s", joinJSONPath(child), jsonText(vb[i])))
+				case i >= len(vb):
+					*diffs = append(*diffs, fmt.Sprintf("body %s: %s != missing", joinJSONPath(child), jsonText(va[i])))
+				default:
+					cp.diffJSON(child, va[i], vb[i], diffs)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*diffs = append(*diffs, fmt.Sprintf("body %s: %s != %s", joinJSONPath(path), jsonText(a), jsonText(b)))
+	}
+}
+
+func joinJSONPath(path []string) string {
+	var sb strings.Builder
+	for i, seg := range path {
+		if i > 0 && !strings.HasPrefix(seg, "[") {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(seg)
+	}
+	return sb.String()
+}
+
+// jsonText 将JSON值格式化为简短的文本, 过长时截断
+func jsonText(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if len(data) > 80 {
+		return string(data[:77]) + "..."
+	}
+	return string(data)
+}
+
+// Print 输出比较的汇总信息, 缺少一侧结果的路径计为未完成
+func (cp *Comparer) Print(w io.Writer) {
+	util.PrintToFile(w, "Compared %d paths: Same: %d Diff: %d", cp.same+cp.diff, cp.same, cp.diff)
+	if len(cp.pending) > 0 {
+		util.PrintToFile(w, " Incomplete: %d", len(cp.pending))
+	}
+	util.PrintToFile(w, "\n")
+}
+
+// Mismatches 返回存在差异的路径数量
+func (cp *Comparer) Mismatches() int {
+	return cp.diff
+}
+
+// ignoreRule 是一条忽略规则
+// JSONPath 中 * 和 [*] 匹配任意字段或下标, $..name 匹配任意深度的字段
+type ignoreRule struct {
+	segments []string
+	anyDepth bool
+	pattern  *regexp.Regexp
+}
+
+// IgnoreRules 是比较时忽略的字段和内容
+type IgnoreRules []ignoreRule
+
+func ParseIgnoreRules(exprs []string) (IgnoreRules, error) {
+	var rules IgnoreRules
+	for _, expr := range exprs {
+		if !strings.HasPrefix(expr, "$") {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ignore rule %q: %w", expr, err)
+			}
+			rules = append(rules, ignoreRule{pattern: re})
+			continue
+		}
+
+		rule := ignoreRule{}
+		rest := expr[1:]
+		if tail, ok := strings.CutPrefix(rest, ".."); ok {
+			rule.anyDepth = true
+			rest = "." + tail
+		}
+		for _, part := range strings.Split(strings.ReplaceAll(rest, "[", ".["), ".") {
+			if part != "" {
+				rule.segments = append(rule.segments, part)
+			}
+		}
+		if len(rule.segments) == 0 {
+			return nil, fmt.Errorf("invalid ignore rule %q: empty path", expr)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Match 判断JSON路径是否被忽略, 忽略一个字段时同时忽略其全部子字段
+func (rules IgnoreRules) Match(path []string) bool {
+	// path[0] 固定为 $
+	path = path[1:]
+	for _, rule := range rules {
+		if rule.pattern != nil || len(path) < len(rule.segments) {
+			continue
+		}
+		if rule.anyDepth {
+			for start := 0; start+len(rule.segments) <= len(path); start++ {
+				if matchSegments(rule.segments, path[start:]) {
+					return true
+				}
+			}
+		} else if matchSegments(rule.segments, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, path []string) bool {
+	for i, p := range pattern {
+		seg := path[i]
+		switch {
+		case p == "*":
+		case p == "[*]" && strings.HasPrefix(seg, "["):
+		case p != seg:
+			return false
+		}
+	}
+	return true
+}
+
+// Strip 去除文本中与正则规则匹配的内容
+func (rules IgnoreRules) Strip(s string) string {
+	for _, rule := range rules {
+		if rule.pattern != nil {
+			s = rule.pattern.ReplaceAllString(s, "")
+		}
+	}
+	return s
+}
@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+func cookieFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "cookie",
+			Aliases: []string{"b"},
+			Usage:   "Cookies to send, either 'name=value; name2=value2' or a Netscape cookie file to load",
+		},
+		&cli.StringFlag{
+			Name:    "cookie-jar",
+			Aliases: []string{"j"},
+			Usage:   "Netscape cookie file loaded before the run (if it exists) and updated with received cookies afterwards",
+		},
+		&cli.BoolFlag{
+			Name:  "session",
+			Usage: "Run requests one by one in input order, sharing cookies between them (e.g. log in, then call APIs)",
+		},
+	}
+}
+
+// NewCookieJarFromFlags 根据命令行参数创建Cookie存储, 不需要保存Cookie时返回nil
+// 字符串形式的 --cookie 直接写入请求模板的Cookie头
+func NewCookieJarFromFlags(c *cli.Command, template *Request) (*CookieJar, error) {
+	var jar *CookieJar
+	if c.Bool("session") || c.String("cookie-jar") != "" {
+		jar = NewCookieJar()
+	}
+
+	if cookie := c.String("cookie"); strings.Contains(cookie, "=") {
+		if _, err := http.ParseCookie(cookie); err != nil {
+			return nil, fmt.Errorf("invalid --cookie %q: %w", cookie, err)
+		}
+		template.Header.Set("Cookie", cookie)
+	} else if cookie != "" {
+		if jar == nil {
+			jar = NewCookieJar()
+		}
+		if err := jar.Load(cookie); err != nil {
+			return nil, fmt.Errorf("failed to load cookie file: %w", err)
+		}
+	}
+
+	if file := c.String("cookie-jar"); file != "" {
+		if _, err := os.Stat(file); err == nil {
+			if err := jar.Load(file); err != nil {
+				return nil, fmt.Errorf("failed to load cookie jar: %w", err)
+			}
+		}
+	}
+	return jar, nil
+}
+
+// CookieJar 是可以导入导出Netscape格式文件的Cookie存储
+// 标准库的 cookiejar 无法遍历全部Cookie, 因此单独实现
+type CookieJar struct {
+	mu      sync.Mutex
+	entries map[string]*jarEntry
+}
+
+// jarEntry 是jar中的一个Cookie
+type jarEntry struct {
+	Name     string
+	Value    string
+	Domain   string
+	HostOnly bool
+	Path     string
+	Secure   bool
+	HttpOnly bool
+	// Expires 为零值表示会话Cookie
+	Expires time.Time
+}
+
+func (e *jarEntry) key() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+func NewCookieJar() *CookieJar {
+	return &CookieJar{entries: map[string]*jarEntry{}}
+}
+
+// SetCookies 按RFC 6265的规则保存响应中的Cookie
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := canonicalCookieHost(u.Hostname())
+	now := time.Now()
+	for _, c := range cookies {
+		e := &jarEntry{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+
+		domain := canonicalCookieHost(strings.TrimPrefix(c.Domain, "."))
+		if domain == "" {
+			e.Domain, e.HostOnly = host, true
+		} else if domainMatch(host, domain) && net.ParseIP(host) == nil {
+			e.Domain = domain
+		} else {
+			// 不允许为其他域名设置Cookie
+			continue
+		}
+
+		if e.Path == "" || !strings.HasPrefix(e.Path, "/") {
+			e.Path = defaultCookiePath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			e.Expires = now.Add(-time.Second)
+		case c.MaxAge > 0:
+			e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			e.Expires = c.Expires
+		}
+
+		if !e.Expires.IsZero() && !e.Expires.After(now) {
+			delete(j.entries, e.key())
+			continue
+		}
+		j.entries[e.key()] = e
+	}
+}
+
+// Cookies 返回请求u时应当携带的Cookie, 路径更长的排在前面
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := canonicalCookieHost(u.Hostname())
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	now := time.Now()
+
+	var matched []*jarEntry
+	for k, e := range j.entries {
+		if !e.Expires.IsZero() && !e.Expires.After(now) {
+			delete(j.entries, k)
+			continue
+		}
+		if e.HostOnly && host != e.Domain || !e.HostOnly && !domainMatch(host, e.Domain) {
+			continue
+		}
+		if !pathMatch(path, e.Path) || e.Secure && u.Scheme != "https" {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	sort.Slice(matched, func(a, b int) bool { return len(matched[a].Path) > len(matched[b].Path) })
+
+	cookies := make([]*http.Cookie, 0, len(matched))
+	for _, e := range matched {
+		cookies = append(cookies, &http.Cookie{Name: e.Name, Value: e.Value})
+	}
+	return cookies
+}
+
+func canonicalCookieHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func pathMatch(path, cookiePath string) bool {
+	if path == cookiePath {
+		return true
+	}
+	return strings.HasPrefix(path, cookiePath) &&
+		(strings.HasSuffix(cookiePath, "/") || path[len(cookiePath)] == '/')
+}
+
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// Load 读取Netscape格式的Cookie文件, 每行字段以Tab分隔:
+// domain, include-subdomains, path, secure, expires, name, value
+func (j *CookieJar) Load(file string) error {
+	// 不能使用 util.GetFileInput, 去掉行尾空白会丢失值为空的Cookie最后的制表符
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		} else if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("invalid cookie line %q, expect 7 tab separated fields", line)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid cookie expiry %q", fields[4])
+		}
+
+		e := &jarEntry{
+			Domain:   canonicalCookieHost(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: fields[1] != "TRUE",
+			Path:     fields[2],
+			Secure:   fields[3] == "TRUE",
+			HttpOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		if expires > 0 {
+			e.Expires = time.Unix(expires, 0)
+		}
+		j.entries[e.key()] = e
+	}
+	return nil
+}
+
+// Save 以Netscape格式写入全部未过期的Cookie, 会话Cookie的过期时间记为0
+func (j *CookieJar) Save(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer util.CloseWithLog(f)
+
+	j.mu.Lock()
+	entries := make([]*jarEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	j.mu.Unlock()
+	sort.Slice(entries, func(a, b int) bool { return entries[a].key() < entries[b].key() })
+
+	w := bufio.NewWriter(f)
+	util.PrintToFile(w, "# Netscape HTTP Cookie File\n# Generated by gmh\n\n")
+	now := time.Now()
+	for _, e := range entries {
+		if !e.Expires.IsZero() && !e.Expires.After(now) {
+			continue
+		}
+		domain := e.Domain
+		if !e.HostOnly {
+			domain = "." + domain
+		}
+		if e.HttpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expires int64
+		if !e.Expires.IsZero() {
+			expires = e.Expires.Unix()
+		}
+		util.PrintToFile(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(!e.HostOnly), e.Path, netscapeBool(e.Secure), expires, e.Name, e.Value)
+	}
+	return w.Flush()
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+func crawlFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "crawl",
+			Usage: "Follow href/src links found in HTML responses and report broken links with the referring page",
+		},
+		&cli.UintFlag{
+			Name:  "depth",
+			Value: 2,
+			Usage: "Maximum link depth from the input URLs in --crawl mode",
+		},
+		&cli.StringSliceFlag{
+			Name:  "allow-host",
+			Usage: "Host crawled in addition to the hosts of the input URLs",
+		},
+		&cli.BoolFlag{
+			Name:  "check-external",
+			Usage: "Also check links to other hosts in --crawl mode, without following their links",
+		},
+		&cli.BoolFlag{
+			Name:  "no-robots",
+			Usage: "Ignore robots.txt in --crawl mode",
+		},
+	}
+}
+
+// crawlUserAgent 是匹配robots.txt规则时使用的名称
+const crawlUserAgent = "gmh"
+
+// Crawler 从输入的URL开始, 提取HTML响应中的链接并继续请求
+// 输入URL的Host和 AllowHosts 中的Host在范围内, 范围外的链接只在 CheckExternal 时检查状态
+type Crawler struct {
+	MaxDepth      int
+	AllowHosts    []string
+	CheckExternal bool
+	Robots        bool
+	// Template 用于构造发现的请求和获取robots.txt
+	Template Request
+	Options  CurlOptions
+
+	mu sync.Mutex
+	// wake 在有新请求入队或请求完成时通知分发者
+	wake  chan struct{}
+	queue []Request
+	// pages 记录已入队的URL, 用于去重和查找来源页面
+	pages map[string]*crawlPage
+	// outstanding 是已入队但尚未完成的请求数量
+	outstanding int
+	next        int
+	robots      map[string]*robotsRules
+	broken      []*crawlPage
+	blocked     int
+}
+
+// crawlPage 是一个已入队的URL
+type crawlPage struct {
+	URL      string
+	Depth    int
+	Referrer string
+	External bool
+	Status   int
+	Err      error
+}
+
+func NewCrawlerFromFlags(c *cli.Command, template Request, opts CurlOptions) (*Crawler, error) {
+	if !c.Bool("crawl") {
+		return nil, nil
+	}
+	if c.String("download") != "" || c.String("compare") != "" {
+		return nil, fmt.Errorf("--crawl cannot be used with --download or --compare")
+	}
+	// 链接提取需要完整的响应体
+	opts.Body = nil
+	return &Crawler{
+		MaxDepth:      int(c.Uint("depth")),
+		AllowHosts:    c.StringSlice("allow-host"),
+		CheckExternal: c.Bool("check-external"),
+		Robots:        !c.Bool("no-robots"),
+		Template:      template,
+		Options:       opts,
+		wake:          make(chan struct{}, 1),
+		pages:         map[string]*crawlPage{},
+		robots:        map[string]*robotsRules{},
+	}, nil
+}
+
+// Crawl 先分发输入的请求, 再分发发现的链接, 所有请求完成且没有新链接时结束
+// 每个请求完成后需要调用 Visit, ctx取消或interrupt关闭时停止分发
+func (cr *Crawler) Crawl(ctx context.Context, interrupt <-chan struct{}, seeds iter.Seq[Request]) iter.Seq[Request] {
+	return func(yield func(Request) bool) {
+		for seed := range seeds {
+			if host := hostOf(seed.URL); !slices.Contains(cr.AllowHosts, host) {
+				cr.AllowHosts = append(cr.AllowHosts, host)
+			}
+			cr.mu.Lock()
+			cr.enqueue(seed, 0, "")
+			cr.mu.Unlock()
+		}
+
+		for {
+			cr.mu.Lock()
+			if len(cr.queue) == 0 {
+				done := cr.outstanding == 0
+				cr.mu.Unlock()
+				if done {
+					return
+				}
+				select {
+				case <-cr.wake:
+				case <-ctx.Done():
+					return
+				case <-interrupt:
+					return
+				}
+				continue
+			}
+			request := cr.queue[0]
+			cr.queue = cr.queue[1:]
+			cr.mu.Unlock()
+
+			if cr.Robots && !cr.allowedByRobots(ctx, request.URL) {
+				cr.mu.Lock()
+				cr.blocked++
+				cr.outstanding--
+				cr.mu.Unlock()
+				continue
+			}
+			if !yield(request) {
+				return
+			}
+		}
+	}
+}
+
+// enqueue 添加一个未访问过的URL, 调用时需要持有锁
+func (cr *Crawler) enqueue(request Request, depth int, referrer string) {
+	key := normalizeCrawlURL(request.URL)
+	if _, ok := cr.pages[key]; ok {
+		return
+	}
+	cr.pages[key] = &crawlPage{
+		URL:      request.URL,
+		Depth:    depth,
+		Referrer: referrer,
+		External: !slices.Contains(cr.AllowHosts, hostOf(request.URL)),
+	}
+	request.Index = cr.next
+	cr.next++
+	cr.queue = append(cr.queue, request)
+	cr.outstanding++
+}
+
+// Visit 记录请求结果, 并将范围内HTML页面中的链接加入队列, 可以并发调用
+func (cr *Crawler) Visit(request Request, rst TaskRst) {
+	var links []string
+	cr.mu.Lock()
+	page := cr.pages[normalizeCrawlURL(request.URL)]
+	cr.mu.Unlock()
+	if page != nil && !page.External && page.Depth < cr.MaxDepth && rst.Err == nil && isHTML(rst) {
+		base := rst.FinalURL
+		if base == "" {
+			base = rst.URL
+		}
+		links = extractLinks(rst.Data, base)
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if page != nil {
+		page.Status, page.Err = rst.StatusCode, rst.Err
+		if rst.Err != nil {
+			cr.broken = append(cr.broken, page)
+		}
+	}
+	for _, link := range links {
+		external := !slices.Contains(cr.AllowHosts, hostOf(link))
+		if external && !cr.CheckExternal {
+			continue
+		}
+		next := cr.Template.Clone()
+		next.URL = link
+		next.Header.Set("Referer", request.URL)
+		cr.enqueue(next, page.Depth+1, request.URL)
+	}
+	cr.outstanding--
+
+	select {
+	case cr.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Print 输出失效链接及其来源页面
+func (cr *Crawler) Print(w io.Writer) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	util.PrintToFile(w, "Crawled %d URLs: Broken: %d Blocked by robots.txt: %d\n", len(cr.pages), len(cr.broken), cr.blocked)
+	for _, p := range cr.broken {
+		referrer := p.Referrer
+		if referrer == "" {
+			referrer = "(input)"
+		}
+		util.PrintToFile(w, "  %s\n    status: %d error: %v\n    from: %s\n", p.URL, p.Status, p.Err, referrer)
+	}
+}
+
+// Broken 返回失效链接的数量
+func (cr *Crawler) Broken() int {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return len(cr.broken)
+}
+
+func isHTML(rst TaskRst) bool {
+	mediaType, _, _ := mime.ParseMediaType(rst.Header.Get("Content-Type"))
+	if mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType([]byte(rst.Data)))
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+var (
+	linkPattern     = regexp.MustCompile(`(?i)\s(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	baseHrefPattern = regexp.MustCompile(`(?i)<base\s[^>]*href\s*=\s*["']?([^"'\s>]+)`)
+	commentPattern  = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+// extractLinks 提取HTML中href和src属性指向的http(s)链接, 按<base>或页面URL解析相对路径
+func extractLinks(html, pageURL string) []string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	html = commentPattern.ReplaceAllString(html, "")
+	if m := baseHrefPattern.FindStringSubmatch(html); m != nil {
+		if b, err := base.Parse(unescapeHTMLAttr(m[1])); err == nil {
+			base = b
+		}
+	}
+
+	var links []string
+	seen := map[string]bool{}
+	for _, m := range linkPattern.FindAllStringSubmatch(html, -1) {
+		raw := strings.TrimSpace(unescapeHTMLAttr(m[1] + m[2] + m[3]))
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+		u, err := base.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		u.Fragment = ""
+		link := u.String()
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+var htmlAttrReplacer = strings.NewReplacer("&amp;", "&", "&quot;", `"`, "&#39;", "'", "&lt;", "<", "&gt;", ">")
+
+func unescapeHTMLAttr(s string) string {
+	return htmlAttrReplacer.Replace(s)
+}
+
+// normalizeCrawlURL 生成用于去重的URL, 忽略片段, 默认端口和Host的大小写
+func normalizeCrawlURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Fragment = ""
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// robotsRules 是robots.txt中适用于本工具的规则
+type robotsRules struct {
+	allow, disallow []*regexp.Regexp
+	// 规则原文的长度, 用于选择最长匹配
+	allowLen, disallowLen []int
+}
+
+// allowedByRobots 检查URL是否被robots.txt禁止, 每个Host只获取一次robots.txt
+func (cr *Crawler) allowedByRobots(ctx context.Context, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+	origin := u.Scheme + "://" + u.Host
+
+	cr.mu.Lock()
+	rules, ok := cr.robots[origin]
+	cr.mu.Unlock()
+	if !ok {
+		request := cr.Template.Clone()
+		request.URL = origin + "/robots.txt"
+		request.Method = http.MethodGet
+		request.Body = nil
+		rst := DoCurl(ctx, request, cr.Options)
+		// 获取失败或不存在时不限制
+		if rst.Err == nil && rst.StatusCode == http.StatusOK {
+			rules = parseRobots(rst.Data, crawlUserAgent)
+		}
+		cr.mu.Lock()
+		cr.robots[origin] = rules
+		cr.mu.Unlock()
+	}
+	return rules.Allowed(u.RequestURI())
+}
+
+// parseRobots 解析robots.txt, 优先使用匹配agent的规则组, 否则使用 * 规则组
+func parseRobots(content, agent string) *robotsRules {
+	var specific, general *robotsRules
+	var current []*robotsRules
+	inRules := false
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// 连续的User-agent行属于同一个规则组
+			if inRules {
+				current, inRules = nil, false
+			}
+			name := strings.ToLower(value)
+			switch {
+			case name == "*":
+				if general == nil {
+					general = &robotsRules{}
+				}
+				current = append(current, general)
+			case strings.Contains(agent, name) || strings.Contains(name, agent):
+				if specific == nil {
+					specific = &robotsRules{}
+				}
+				current = append(current, specific)
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			re := robotsPattern(value)
+			for _, r := range current {
+				if key == "allow" {
+					r.allow, r.allowLen = append(r.allow, re), append(r.allowLen, len(value))
+				} else {
+					r.disallow, r.disallowLen = append(r.disallow, re), append(r.disallowLen, len(value))
+				}
+			}
+		}
+	}
+	if specific != nil {
+		return specific
+	}
+	return general
+}
+
+// robotsPattern 将robots.txt的路径规则转换为正则, 支持 * 和结尾的 $
+func robotsPattern(rule string) *regexp.Regexp {
+	anchored := strings.HasSuffix(rule, "$")
+	rule = strings.TrimSuffix(rule, "$")
+	parts := strings.Split(rule, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	pattern := "^" + strings.Join(parts, ".*")
+	if anchored {
+		pattern += "$"
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// Allowed 按最长匹配的规则判断路径是否允许访问, 长度相同时Allow优先
+func (r *robotsRules) Allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	longest := func(patterns []*regexp.Regexp, lens []int) int {
+		best := -1
+		for i, re := range patterns {
+			if lens[i] > best && re.MatchString(path) {
+				best = lens[i]
+			}
+		}
+		return best
+	}
+	return longest(r.allow, r.allowLen) >= longest(r.disallow, r.disallowLen)
+}
@@ -0,0 +1,433 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+)
+
+// 默认的文件名模板, 按 host/path 的目录结构保存
+const defaultNameTemplate = "{host}/{path}"
+
+// Downloader 将每个响应体写入单独的文件, 支持断点续传和校验
+type Downloader struct {
+	Dir          string
+	NameTemplate string
+	// Checksums 按文件名查找期望的校验值, 请求中指定的校验值优先
+	Checksums map[string]string
+
+	progress downloadProgress
+
+	// 同一批请求中不同的请求可能生成相同的文件名, 例如只有查询参数不同的URL
+	// names 按请求位置记录实际使用的文件名, owners 记录每个文件名属于哪个请求
+	mu     sync.Mutex
+	names  map[int]string
+	owners map[string]int
+}
+
+// NewDownloader 创建保存到dir目录的下载器
+func NewDownloader(dir, nameTemplate string) *Downloader {
+	if nameTemplate == "" {
+		nameTemplate = defaultNameTemplate
+	}
+	return &Downloader{
+		Dir:          dir,
+		NameTemplate: nameTemplate,
+		Checksums:    map[string]string{},
+		progress:     downloadProgress{active: map[string]*fileProgress{}},
+		names:        map[int]string{},
+		owners:       map[string]int{},
+	}
+}
+
+// LoadChecksumFile 读取 sha256sum 格式的校验文件, 每行为 "HEX  文件名"
+func (d *Downloader) LoadChecksumFile(file string) error {
+	lines, err := util.GetFileInput(file)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return fmt.Errorf("invalid checksum line %q, expect 'HEX  FILENAME'", line)
+		}
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		d.Checksums[filepath.ToSlash(name)] = sum
+	}
+	return nil
+}
+
+// FileName 根据模板生成相对于下载目录的文件名, 可用的占位符:
+//
+//	{index} 输入中的位置  {host} 主机名  {path} URL路径  {base} 路径最后一段
+//	{ext} 扩展名  {hash} URL的SHA1前12位
+func (d *Downloader) FileName(r Request) string {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		u = &url.URL{Path: r.URL}
+	}
+
+	p := strings.TrimPrefix(path.Clean("/"+u.Path), "/")
+	if p == "" || strings.HasSuffix(u.Path, "/") {
+		p = path.Join(p, "index.html")
+	}
+	sum := sha1.Sum([]byte(r.URL))
+
+	name := strings.NewReplacer(
+		"{index}", strconv.Itoa(r.Index),
+		"{host}", u.Hostname(),
+		"{path}", p,
+		"{base}", path.Base(p),
+		"{ext}", path.Ext(p),
+		"{hash}", hex.EncodeToString(sum[:])[:12],
+	).Replace(d.NameTemplate)
+
+	return sanitizePath(name)
+}
+
+// AssignFileName 返回请求在本次下载中使用的文件名, 同一请求重试时返回相同的文件名
+// 模板生成的文件名已被输入中更早的请求使用时, 在扩展名前依次尝试加上URL的哈希和请求的位置,
+// 避免多个请求同时写入同一个 .part 文件. 需要在发送前按输入顺序调用, 保证重新运行时文件名不变
+func (d *Downloader) AssignFileName(r Request) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if name, ok := d.names[r.Index]; ok {
+		return name
+	}
+
+	name := d.FileName(r)
+	if _, taken := d.owners[name]; taken {
+		ext := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		sum := sha1.Sum([]byte(r.URL))
+		name = stem + "-" + hex.EncodeToString(sum[:])[:12] + ext
+		if _, taken := d.owners[name]; taken {
+			// URL也相同时只能按位置区分
+			name = stem + "-" + strconv.Itoa(r.Index) + ext
+		}
+	}
+	d.names[r.Index] = name
+	d.owners[name] = r.Index
+	return name
+}
+
+// sanitizePath 去掉路径中的 .. 和不能用于文件名的字符, 保证文件写在下载目录中
+func sanitizePath(name string) string {
+	var parts []string
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		part = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`<>:"\|?*`, r) || r < 0x20 {
+				return '_'
+			}
+			return r
+		}, part)
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "index.html"
+	}
+	return filepath.Join(parts...)
+}
+
+// Prepare 存在同一URL未完成的下载时, 通过Range请求继续下载剩余部分
+func (d *Downloader) Prepare(r Request, req *http.Request) error {
+	part := filepath.Join(d.Dir, d.AssignFileName(r)) + ".part"
+	if info, err := os.Stat(part); err == nil && info.Size() > 0 {
+		if owner, err := os.ReadFile(partURLFile(part)); err == nil && string(owner) == r.URL {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+		} else {
+			// 无法确认部分文件属于该URL, 续传可能拼接其他URL的内容, 删除后重新下载
+			_ = os.Remove(part)
+		}
+	}
+	return nil
+}
+
+// partURLFile 返回记录 .part 文件所属URL的文件名
+func partURLFile(part string) string {
+	return part + ".url"
+}
+
+// Consume 将响应体写入 .part 文件, 下载完成并校验通过后重命名为最终文件名
+func (d *Downloader) Consume(r Request, resp *http.Response, rst *TaskRst) error {
+	name := d.AssignFileName(r)
+	target := filepath.Join(d.Dir, name)
+	part := target + ".part"
+	rst.File = target
+	rst.Data = target
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// 错误页面不写入文件, 416说明已有的部分文件与服务端不一致, 删除后重新下载
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			_ = os.Remove(part)
+			_ = os.Remove(partURLFile(part))
+		}
+		n, err := io.Copy(io.Discard, resp.Body)
+		rst.Size = n
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// 206表示服务端接受了Range请求, 在已有内容后追加, 否则从头写入
+	var offset int64
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resp.StatusCode == http.StatusPartialContent {
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		offset = start
+		flag = os.O_CREATE | os.O_WRONLY
+	}
+
+	f, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer util.CloseWithLog(f)
+	if offset == 0 {
+		if err := os.WriteFile(partURLFile(part), []byte(r.URL), 0644); err != nil {
+			return err
+		}
+	}
+	if offset > 0 {
+		if err := f.Truncate(offset); err != nil {
+			return err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	checksum := r.Checksum
+	if checksum == "" {
+		checksum = d.Checksums[filepath.ToSlash(name)]
+	}
+	if checksum == "" {
+		checksum = d.Checksums[path.Base(filepath.ToSlash(name))]
+	}
+	var h hash.Hash
+	var expect string
+	if checksum != "" {
+		if h, expect, err = parseChecksum(checksum); err != nil {
+			return err
+		}
+		// 续传时需要先计算已下载部分的校验值
+		if offset > 0 {
+			if err := hashFilePrefix(h, part, offset); err != nil {
+				return err
+			}
+		}
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	fp := d.progress.start(name, offset, total)
+	completed := false
+	defer func() { d.progress.finish(name, completed) }()
+
+	var w io.Writer = f
+	if h != nil {
+		w = io.MultiWriter(f, h)
+	}
+	n, err := io.Copy(io.MultiWriter(w, fp), resp.Body)
+	rst.Size = offset + n
+	if err != nil {
+		return err
+	}
+
+	if h != nil {
+		if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expect) {
+			// 内容已损坏, 删除后下次重新下载
+			_ = os.Remove(part)
+			_ = os.Remove(partURLFile(part))
+			return fmt.Errorf("checksum mismatch for %s: expect %s, got %s", target, expect, actual)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(part, target); err != nil {
+		return err
+	}
+	_ = os.Remove(partURLFile(part))
+	completed = true
+	return nil
+}
+
+// contentRangeStart 解析 "bytes start-end/total" 中的start
+func contentRangeStart(value string) (int64, error) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	start, _, found := strings.Cut(spec, "-")
+	n, err := strconv.ParseInt(start, 10, 64)
+	if !ok || !found || err != nil {
+		return 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	return n, nil
+}
+
+// parseChecksum 解析 "算法:HEX" 形式的校验值, 省略算法时按长度推断
+func parseChecksum(checksum string) (hash.Hash, string, error) {
+	algo, sum, ok := strings.Cut(checksum, ":")
+	if !ok {
+		sum = checksum
+		switch len(sum) {
+		case 32:
+			algo = "md5"
+		case 40:
+			algo = "sha1"
+		case 64:
+			algo = "sha256"
+		case 128:
+			algo = "sha512"
+		}
+	}
+
+	switch strings.ToLower(algo) {
+	case "md5":
+		return md5.New(), sum, nil
+	case "sha1":
+		return sha1.New(), sum, nil
+	case "sha256":
+		return sha256.New(), sum, nil
+	case "sha512":
+		return sha512.New(), sum, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported checksum %q, use md5, sha1, sha256 or sha512", checksum)
+	}
+}
+
+func hashFilePrefix(h hash.Hash, file string, n int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer util.CloseWithLog(f)
+	_, err = io.CopyN(h, f, n)
+	return err
+}
+
+// fileProgress 记录一个文件的下载进度, 实现io.Writer以便在复制时计数
+type fileProgress struct {
+	done  atomic.Int64
+	total int64
+	start time.Time
+	base  int64
+}
+
+func (p *fileProgress) Write(b []byte) (int, error) {
+	p.done.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// downloadProgress 汇总所有文件的下载进度
+type downloadProgress struct {
+	mu       sync.Mutex
+	active   map[string]*fileProgress
+	files    int
+	finished int64
+}
+
+func (d *downloadProgress) start(name string, offset, total int64) *fileProgress {
+	p := &fileProgress{total: total, start: time.Now(), base: offset}
+	p.done.Store(offset)
+	d.mu.Lock()
+	d.active[name] = p
+	d.mu.Unlock()
+	return p
+}
+
+func (d *downloadProgress) finish(name string, completed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p, ok := d.active[name]; ok {
+		if completed {
+			d.files++
+		}
+		d.finished += p.done.Load() - p.base
+		delete(d.active, name)
+	}
+}
+
+// ShowProgress 每隔interval在w中输出进度, 调用返回的函数停止输出并打印汇总
+func (d *Downloader) ShowProgress(w io.Writer, interval time.Duration) (stop func()) {
+	begin := time.Now()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				d.printProgress(w, begin)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		d.printProgress(w, begin)
+	}
+}
+
+func (d *downloadProgress) snapshot() (files int, bytes int64, lines []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bytes = d.finished
+	for name, p := range d.active {
+		done := p.done.Load()
+		bytes += done - p.base
+		speed := float64(done-p.base) / time.Since(p.start).Seconds()
+		if p.total > 0 {
+			lines = append(lines, fmt.Sprintf("  %s %s/%s (%.1f%%) %s/s", name,
+				formatBytes(float64(done)), formatBytes(float64(p.total)), 100*float64(done)/float64(p.total), formatBytes(speed)))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s %s %s/s", name, formatBytes(float64(done)), formatBytes(speed)))
+		}
+	}
+	sort.Strings(lines)
+	return d.files, bytes, lines
+}
+
+func (d *Downloader) printProgress(w io.Writer, begin time.Time) {
+	files, bytes, lines := d.progress.snapshot()
+	elapsed := time.Since(begin)
+	util.PrintToFile(w, "Downloaded %d files, %s in %v (%s/s), %d in progress\n",
+		files, formatBytes(float64(bytes)), elapsed.Round(time.Second), formatBytes(float64(bytes)/elapsed.Seconds()), len(lines))
+	for _, line := range lines {
+		util.PrintToFile(w, "%s\n", line)
+	}
+}
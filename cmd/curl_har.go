@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+func harFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "har",
+			Usage: "Write every request/response with timings to the file in HAR 1.2 format",
+		},
+		&cli.StringFlag{
+			Name:  "from-har",
+			Usage: "Replay the requests recorded in the HAR file instead of reading URLs",
+		},
+	}
+}
+
+// HAR 1.2 格式的定义, 只包含本工具读写的字段
+// 参考 http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []harNameValue `json:"params,omitempty"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// harTimings 中不适用的阶段为-1, connect 包含 ssl 的耗时
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HarWriter 边执行边写入HAR文件, 避免在内存中保存全部响应
+type HarWriter struct {
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	urlOnly bool
+	count   int
+}
+
+// NewHarWriter 创建HAR文件并写入文件头, urlOnly为true时不记录响应内容
+func NewHarWriter(file string, urlOnly bool) (*HarWriter, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	h := &HarWriter{f: f, w: bufio.NewWriter(f), urlOnly: urlOnly}
+	creator, _ := json.Marshal(harCreator{Name: "gmh", Version: "1.0"})
+	util.PrintToFile(h.w, "{\n  \"log\": {\n    \"version\": \"1.2\",\n    \"creator\": %s,\n    \"entries\": [", creator)
+	return h, nil
+}
+
+// Write 写入一个结果, 没有实际发出的请求会被忽略
+func (h *HarWriter) Write(rst TaskRst) {
+	if rst.RequestHeader == nil {
+		return
+	}
+	data, err := json.MarshalIndent(newHarEntry(rst, h.urlOnly), "      ", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count > 0 {
+		util.PrintToFile(h.w, ",")
+	}
+	util.PrintToFile(h.w, "\n      %s", data)
+	h.count++
+}
+
+// Close 写入文件尾并关闭文件
+func (h *HarWriter) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	util.PrintToFile(h.w, "\n    ]\n  }\n}\n")
+	if err := h.w.Flush(); err != nil {
+		_ = h.f.Close()
+		return err
+	}
+	return h.f.Close()
+}
+
+func newHarEntry(rst TaskRst, urlOnly bool) harEntry {
+	// 跟随重定向时记录的是最后一跳的请求和响应
+	rawURL := rst.URL
+	if rst.FinalURL != "" {
+		rawURL = rst.FinalURL
+	}
+
+	e := harEntry{
+		StartedDateTime: rst.Start.Format(time.RFC3339Nano),
+		Time:            durationMs(rst.Duration),
+		Request: harRequest{
+			Method:      rst.Method,
+			URL:         rawURL,
+			HTTPVersion: rst.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(rst.RequestHeader),
+			QueryString: harQuery(rawURL),
+			HeadersSize: -1,
+			BodySize:    len(rst.RequestBody),
+		},
+		Response: harResponse{
+			Status:      rst.StatusCode,
+			HTTPVersion: rst.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(rst.Header),
+			RedirectURL: rst.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    rst.Size,
+			Content: harContent{
+				Size:     rst.Size,
+				MimeType: rst.Header.Get("Content-Type"),
+			},
+		},
+		Timings: harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: durationMs(rst.Duration)},
+	}
+	if rst.RequestBody != nil {
+		e.Request.PostData = &harPostData{
+			MimeType: rst.RequestHeader.Get("Content-Type"),
+			Text:     string(rst.RequestBody),
+		}
+	}
+	if rst.StatusCode != 0 {
+		e.Response.StatusText = http.StatusText(rst.StatusCode)
+	}
+	if !urlOnly && rst.File == "" && rst.Data != "" {
+		if utf8.ValidString(rst.Data) {
+			e.Response.Content.Text = rst.Data
+		} else {
+			e.Response.Content.Text = base64.StdEncoding.EncodeToString([]byte(rst.Data))
+			e.Response.Content.Encoding = "base64"
+		}
+	}
+	if t := rst.Timing; t != nil {
+		e.Timings = harTimings{
+			Blocked: -1,
+			DNS:     durationMs(t.DNS),
+			Connect: durationMs(t.Connect + t.TLS),
+			SSL:     durationMs(t.TLS),
+			Wait:    durationMs(t.TTFB),
+			Receive: durationMs(t.Transfer),
+		}
+		// 复用连接时没有DNS和连接阶段
+		if t.DNS == 0 {
+			e.Timings.DNS = -1
+		}
+		if t.Connect == 0 {
+			e.Timings.Connect, e.Timings.SSL = -1, -1
+		} else if t.TLS == 0 {
+			e.Timings.SSL = -1
+		}
+	}
+	if rst.Err != nil {
+		e.Error = rst.Err.Error()
+	}
+	return e
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	values := []harNameValue{}
+	for _, name := range names {
+		for _, v := range header[name] {
+			values = append(values, harNameValue{Name: name, Value: v})
+		}
+	}
+	return values
+}
+
+func harQuery(rawURL string) []harNameValue {
+	values := []harNameValue{}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return values
+	}
+	for _, kv := range strings.Split(u.RawQuery, "&") {
+		if kv == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(kv, "=")
+		name, _ = url.QueryUnescape(name)
+		value, _ = url.QueryUnescape(value)
+		values = append(values, harNameValue{Name: name, Value: value})
+	}
+	return values
+}
+
+// harSkipHeaders 是重放时不复制的请求头, 由Transport根据实际连接生成
+var harSkipHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Te":                true,
+}
+
+// ReadHarRequests 读取HAR文件中记录的请求, 命令行指定的请求头优先于HAR中的请求头
+func ReadHarRequests(file string, template Request) ([]Request, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file %s: %w", file, err)
+	}
+
+	requests := make([]Request, 0, len(har.Log.Entries))
+	for i, entry := range har.Log.Entries {
+		hr := entry.Request
+		if hr.URL == "" {
+			return nil, fmt.Errorf("invalid HAR file %s: entry %d has no url", file, i)
+		}
+
+		req := template.Clone()
+		req.Index = i
+		req.URL = hr.URL
+		if hr.Method != "" {
+			req.Method = strings.ToUpper(hr.Method)
+		}
+		for _, h := range hr.Headers {
+			// HTTP/2 的伪头部(:authority等)以冒号开头
+			name := http.CanonicalHeaderKey(h.Name)
+			if strings.HasPrefix(name, ":") || harSkipHeaders[name] || template.Header.Get(name) != "" {
+				continue
+			}
+			req.Header.Add(name, h.Value)
+		}
+		if pd := hr.PostData; pd != nil {
+			req.Body = []byte(pd.Text)
+			if pd.Text == "" && len(pd.Params) > 0 {
+				form := url.Values{}
+				for _, p := range pd.Params {
+					form.Add(p.Name, p.Value)
+				}
+				req.Body = []byte(form.Encode())
+			}
+			if req.Header.Get("Content-Type") == "" && pd.MimeType != "" {
+				req.Header.Set("Content-Type", pd.MimeType)
+			}
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
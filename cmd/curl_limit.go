@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter 令牌桶限速器, 以固定速率补充令牌, 最多积攒burst个
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 创建每秒产生rate个令牌的限速器
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	burst = max(burst, 1)
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait 阻塞直到获得一个令牌或ctx结束, nil限速器不做任何限制
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	// 先预定令牌再等待, 令牌数允许为负以保证请求按顺序获得令牌
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	return sleepContext(ctx, wait)
+}
+
+// ParseRate 解析 "N", "N/s", "N/m" 或 "N/h" 形式的速率, 返回每秒请求数
+func ParseRate(expr string) (float64, error) {
+	num, unit, _ := strings.Cut(strings.TrimSpace(expr), "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate %q, expect a positive number like 100/s", expr)
+	}
+
+	switch unit {
+	case "", "s":
+		return n, nil
+	case "m":
+		return n / 60, nil
+	case "h":
+		return n / 3600, nil
+	default:
+		return 0, fmt.Errorf("invalid rate unit %q, use s, m or h", unit)
+	}
+}
+
+// sleepContext 等待指定时间, ctx结束时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// HostLimiter 限制每个Host上同时进行的请求数
+type HostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	sems  map[string]chan struct{}
+}
+
+// NewHostLimiter 创建每个Host最多limit个并发的限制器
+func NewHostLimiter(limit int) *HostLimiter {
+	return &HostLimiter{limit: limit, sems: map[string]chan struct{}{}}
+}
+
+// Acquire 获取host的并发名额, 成功时返回释放函数, nil限制器不做任何限制
+func (h *HostLimiter) Acquire(ctx context.Context, host string) (release func(), err error) {
+	if h == nil {
+		return func() {}, nil
+	}
+
+	h.mu.Lock()
+	sem, ok := h.sems[host]
+	if !ok {
+		sem = make(chan struct{}, h.limit)
+		h.sems[host] = sem
+	}
+	h.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,351 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+)
+
+// ResultWriter 按指定格式输出请求结果
+type ResultWriter interface {
+	Write(rst TaskRst)
+	Flush()
+}
+
+// OutputOptions 控制结果输出的内容
+type OutputOptions struct {
+	UrlOnly  bool
+	Timing   bool
+	ShowCert bool
+	// Redirects 输出每个结果的重定向链
+	Redirects bool
+	// Body 控制响应体的展示方式, 结构化格式中不做格式化
+	Body BodyRender
+}
+
+// NewResultWriter 创建指定格式的结果输出器, 支持 text, json, jsonl, csv, table
+func NewResultWriter(format string, w io.Writer, opts OutputOptions) (ResultWriter, error) {
+	switch format {
+	case "", "text":
+		return &textWriter{w: w, opts: opts}, nil
+	case "json":
+		return &jsonWriter{w: w, opts: opts}, nil
+	case "jsonl":
+		return &jsonlWriter{w: w, opts: opts}, nil
+	case "csv":
+		return newCsvWriter(w, opts), nil
+	case "table":
+		return newTableWriter(w, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid format value: %s. Use text, json, jsonl, csv or table", format)
+	}
+}
+
+// resultRecord 是请求结果的结构化表示
+type resultRecord struct {
+	Index      int           `json:"index"`
+	URL        string        `json:"url"`
+	Method     string        `json:"method"`
+	Proto      string        `json:"proto,omitempty"`
+	FinalURL   string        `json:"final_url,omitempty"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Header     http.Header   `json:"headers,omitempty"`
+	Size       int64         `json:"size"`
+	Retries    int           `json:"retries"`
+	TimeMs     float64       `json:"time_ms"`
+	Timing     *timingMs     `json:"timing,omitempty"`
+	Certs      []certInfo    `json:"certs,omitempty"`
+	Redirects  []hopRecord   `json:"redirects,omitempty"`
+	Stream     *streamRecord `json:"stream,omitempty"`
+	File       string        `json:"file,omitempty"`
+	Success    bool          `json:"success"`
+	Error      string        `json:"error,omitempty"`
+	Body       string        `json:"body,omitempty"`
+}
+
+func newResultRecord(rst TaskRst, opts OutputOptions) resultRecord {
+	r := resultRecord{
+		Index:      rst.Index,
+		URL:        rst.URL,
+		Method:     rst.Method,
+		Proto:      rst.Proto,
+		FinalURL:   rst.FinalURL,
+		StatusCode: rst.StatusCode,
+		Header:     rst.Header,
+		Size:       rst.Size,
+		File:       rst.File,
+		Retries:    rst.Retries,
+		TimeMs:     durationMs(rst.Duration),
+		Success:    rst.Err == nil,
+	}
+	if rst.Timing != nil {
+		r.Timing = &timingMs{
+			DNS:      durationMs(rst.Timing.DNS),
+			Connect:  durationMs(rst.Timing.Connect),
+			TLS:      durationMs(rst.Timing.TLS),
+			TTFB:     durationMs(rst.Timing.TTFB),
+			Transfer: durationMs(rst.Timing.Transfer),
+		}
+	}
+	for _, h := range rst.Redirects {
+		r.Redirects = append(r.Redirects, hopRecord{
+			URL:        h.URL,
+			StatusCode: h.StatusCode,
+			Location:   h.Location,
+			TimeMs:     durationMs(h.Duration),
+		})
+	}
+	if st := rst.Stream; st != nil {
+		r.Stream = &streamRecord{
+			Events:       st.Events,
+			Bytes:        st.Bytes,
+			FirstEventMs: durationMs(st.FirstEvent),
+			LastEventID:  st.LastEventID,
+			Reconnects:   st.Reconnects,
+		}
+	}
+	if rst.Err != nil {
+		r.Error = rst.Err.Error()
+	}
+	if opts.ShowCert {
+		r.Certs = newCertInfos(rst.Certs)
+	}
+	if !opts.UrlOnly && rst.File == "" {
+		r.Body = BodyRender{Binary: opts.Body.Binary}.Render(rst)
+	}
+	return r
+}
+
+// hopRecord 是重定向链中一跳的结构化表示
+type hopRecord struct {
+	URL        string  `json:"url"`
+	StatusCode int     `json:"status_code"`
+	Location   string  `json:"location"`
+	TimeMs     float64 `json:"time_ms"`
+}
+
+// streamRecord 是流式接收统计的结构化表示
+type streamRecord struct {
+	Events       int     `json:"events"`
+	Bytes        int64   `json:"bytes"`
+	FirstEventMs float64 `json:"first_event_ms"`
+	LastEventID  string  `json:"last_event_id,omitempty"`
+	Reconnects   int     `json:"reconnects"`
+}
+
+// timingMs 以毫秒表示的阶段耗时
+type timingMs struct {
+	DNS      float64 `json:"dns_ms"`
+	Connect  float64 `json:"connect_ms"`
+	TLS      float64 `json:"tls_ms"`
+	TTFB     float64 `json:"ttfb_ms"`
+	Transfer float64 `json:"transfer_ms"`
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// textWriter 保持原有的输出方式, 每个结果输出响应内容
+// 开启timing, show-cert或show-redirects时改为输出耗时明细, 证书链和重定向链
+type textWriter struct {
+	w    io.Writer
+	opts OutputOptions
+}
+
+func (t *textWriter) Write(rst TaskRst) {
+	if !t.opts.Timing && !t.opts.ShowCert && !t.opts.Redirects {
+		// 流式响应已在接收时输出
+		if rst.Stream != nil {
+			return
+		}
+		util.PrintToFile(t.w, "%s\n", t.opts.Body.Render(rst))
+		return
+	}
+
+	if t.opts.Timing {
+		detail := "-"
+		if rst.Timing != nil {
+			detail = rst.Timing.String()
+		}
+		util.PrintToFile(t.w, "%s %d total=%v %s\n", rst.URL, rst.StatusCode, rst.Duration.Round(time.Microsecond), detail)
+	} else {
+		util.PrintToFile(t.w, "%s %d\n", rst.URL, rst.StatusCode)
+	}
+
+	if t.opts.Redirects {
+		printRedirects(t.w, rst.Redirects)
+	}
+	if t.opts.ShowCert {
+		printCertChain(t.w, rst.Certs)
+	}
+}
+
+func (t *textWriter) Flush() {}
+
+// jsonWriter 收集全部结果后输出为一个JSON数组
+type jsonWriter struct {
+	w       io.Writer
+	opts    OutputOptions
+	records []resultRecord
+}
+
+func (j *jsonWriter) Write(rst TaskRst) {
+	j.records = append(j.records, newResultRecord(rst, j.opts))
+}
+
+func (j *jsonWriter) Flush() {
+	if j.records == nil {
+		j.records = []resultRecord{}
+	}
+	data, err := json.MarshalIndent(j.records, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	util.PrintToFile(j.w, "%s\n", data)
+}
+
+// jsonlWriter 每个结果输出一行JSON
+type jsonlWriter struct {
+	w    io.Writer
+	opts OutputOptions
+}
+
+func (j *jsonlWriter) Write(rst TaskRst) {
+	data, err := json.Marshal(newResultRecord(rst, j.opts))
+	if err != nil {
+		panic(err)
+	}
+	util.PrintToFile(j.w, "%s\n", data)
+}
+
+func (j *jsonlWriter) Flush() {}
+
+var summaryColumns = []string{"index", "status", "size", "time_ms", "retries", "method", "url", "final_url", "error"}
+
+var timingColumns = []string{"dns_ms", "connect_ms", "tls_ms", "ttfb_ms", "transfer_ms"}
+
+var certColumns = []string{"cert_subject", "cert_issuer", "cert_not_after"}
+
+func summaryHeader(opts OutputOptions) []string {
+	header := slices.Clone(summaryColumns)
+	if opts.Timing {
+		header = append(header, timingColumns...)
+	}
+	if opts.ShowCert {
+		header = append(header, certColumns...)
+	}
+	if opts.Redirects {
+		header = append(header, "redirects")
+	}
+	return header
+}
+
+func formatMs(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 2, 64)
+}
+
+func summaryRow(rst TaskRst, opts OutputOptions) []string {
+	r := newResultRecord(rst, OutputOptions{UrlOnly: true})
+	status := ""
+	if r.StatusCode != 0 {
+		status = strconv.Itoa(r.StatusCode)
+	}
+	row := []string{
+		strconv.Itoa(r.Index),
+		status,
+		strconv.FormatInt(r.Size, 10),
+		formatMs(r.TimeMs),
+		strconv.Itoa(r.Retries),
+		r.Method,
+		r.URL,
+		r.FinalURL,
+		r.Error,
+	}
+	if opts.Timing {
+		t := r.Timing
+		if t == nil {
+			t = &timingMs{}
+		}
+		row = append(row, formatMs(t.DNS), formatMs(t.Connect), formatMs(t.TLS), formatMs(t.TTFB), formatMs(t.Transfer))
+	}
+	if opts.ShowCert {
+		if len(rst.Certs) > 0 {
+			leaf := rst.Certs[0]
+			row = append(row, leaf.Subject.String(), leaf.Issuer.String(), leaf.NotAfter.Format(time.RFC3339))
+		} else {
+			row = append(row, "", "", "")
+		}
+	}
+	if opts.Redirects {
+		row = append(row, formatRedirects(rst.Redirects))
+	}
+	return row
+}
+
+// csvWriter 以CSV格式输出结果摘要, 不包含响应内容
+type csvWriter struct {
+	w    *csv.Writer
+	opts OutputOptions
+}
+
+func newCsvWriter(w io.Writer, opts OutputOptions) *csvWriter {
+	c := &csvWriter{w: csv.NewWriter(w), opts: opts}
+	c.write(summaryHeader(opts))
+	return c
+}
+
+func (c *csvWriter) write(row []string) {
+	if err := c.w.Write(row); err != nil {
+		panic(err)
+	}
+}
+
+func (c *csvWriter) Write(rst TaskRst) {
+	c.write(summaryRow(rst, c.opts))
+}
+
+func (c *csvWriter) Flush() {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		panic(err)
+	}
+}
+
+// tableWriter 以对齐的表格输出结果摘要, 不包含响应内容
+type tableWriter struct {
+	w    *tabwriter.Writer
+	opts OutputOptions
+}
+
+func newTableWriter(w io.Writer, opts OutputOptions) *tableWriter {
+	t := &tableWriter{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0), opts: opts}
+	t.write(summaryHeader(opts))
+	return t
+}
+
+func (t *tableWriter) write(row []string) {
+	for i, col := range row {
+		row[i] = strings.ReplaceAll(col, "\t", " ")
+	}
+	util.PrintToFile(t.w, "%s\n", strings.Join(row, "\t"))
+}
+
+func (t *tableWriter) Write(rst TaskRst) {
+	t.write(summaryRow(rst, t.opts))
+}
+
+func (t *tableWriter) Flush() {
+	if err := t.w.Flush(); err != nil {
+		panic(err)
+	}
+}
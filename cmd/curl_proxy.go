@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewProxyFunc 返回Transport使用的代理选择函数
+// proxy为空时沿用环境变量中的代理设置, noProxy中的Host始终直连
+func NewProxyFunc(proxy string, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == "" && noProxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	next := http.ProxyFromEnvironment
+	if proxy != "" {
+		// 未指定协议时按HTTP代理处理
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q. Use http, https or socks5", u.Scheme)
+		}
+		next = http.ProxyURL(u)
+	}
+
+	bypass := parseNoProxy(noProxy)
+	return func(req *http.Request) (*url.URL, error) {
+		if bypass(req.URL.Hostname()) {
+			return nil, nil
+		}
+		return next(req)
+	}, nil
+}
+
+// parseNoProxy 解析逗号分隔的直连列表, 支持 '*', 域名后缀和IP/CIDR
+func parseNoProxy(noProxy string) func(host string) bool {
+	var domains []string
+	var nets []*net.IPNet
+	all := false
+	for _, item := range strings.Split(noProxy, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch {
+		case item == "":
+		case item == "*":
+			all = true
+		case strings.Contains(item, "/"):
+			if _, n, err := net.ParseCIDR(item); err == nil {
+				nets = append(nets, n)
+			}
+		default:
+			domains = append(domains, strings.TrimPrefix(item, "."))
+		}
+	}
+
+	return func(host string) bool {
+		if all {
+			return true
+		}
+		host = strings.ToLower(host)
+		if ip := net.ParseIP(host); ip != nil {
+			for _, n := range nets {
+				if n.Contains(ip) {
+					return true
+				}
+			}
+		}
+		for _, d := range domains {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AddrMap 将 host:port 映射到实际连接的地址, 实现curl的 --resolve 和 --connect-to
+type AddrMap map[string]string
+
+// AddResolve 解析 host:port:addr 形式的映射, 只替换连接的IP地址
+func (m AddrMap) AddResolve(entry string) error {
+	host, port, addr, err := splitMapping(entry)
+	if err != nil {
+		return fmt.Errorf("invalid --resolve %q, expect host:port:addr", entry)
+	}
+	m[net.JoinHostPort(strings.ToLower(host), port)] = net.JoinHostPort(addr, port)
+	return nil
+}
+
+// AddConnectTo 解析 host1:port1:host2:port2 形式的映射, 将连接转向另一个地址
+func (m AddrMap) AddConnectTo(entry string) error {
+	parts := splitHostList(entry)
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[2] == "" || parts[3] == "" {
+		return fmt.Errorf("invalid --connect-to %q, expect host1:port1:host2:port2", entry)
+	}
+	m[net.JoinHostPort(strings.ToLower(parts[0]), parts[1])] = net.JoinHostPort(parts[2], parts[3])
+	return nil
+}
+
+func splitMapping(entry string) (host, port, addr string, err error) {
+	parts := splitHostList(entry)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid mapping")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// splitHostList 按冒号分割, 方括号中的IPv6地址作为整体
+func splitHostList(entry string) []string {
+	var parts []string
+	var cur strings.Builder
+	depth := 0
+	for _, r := range entry {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == ':' && depth == 0:
+			parts = append(parts, cur.String())
+			cur.Reset()
+			continue
+		}
+		if r != '[' && r != ']' {
+			cur.WriteRune(r)
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// WrapDial 在拨号前按映射替换目标地址, 映射为空时直接返回原函数
+func (m AddrMap) WrapDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(m) == 0 {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if target, ok := m[strings.ToLower(addr)]; ok {
+			addr = target
+		}
+		return dial(ctx, network, addr)
+	}
+}
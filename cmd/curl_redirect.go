@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+func redirectFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-follow",
+			Usage: "Do not follow redirects, report the 3xx response itself",
+		},
+		&cli.UintFlag{
+			Name:  "max-redirs",
+			Value: 10,
+			Usage: "Maximum number of redirects to follow, exceeding it is an error",
+		},
+		&cli.BoolFlag{
+			Name:  "show-redirects",
+			Usage: "Show the redirect chain (status, Location, time per hop) of each URL",
+		},
+	}
+}
+
+// RedirectPolicy 控制重定向的跟随方式
+// 301/302/303 按浏览器的行为改为GET请求, 307/308 保持原有的方法和请求体
+type RedirectPolicy struct {
+	NoFollow bool
+	Max      int
+}
+
+// defaultRedirectPolicy 与标准库的默认行为一致
+var defaultRedirectPolicy = RedirectPolicy{Max: 10}
+
+func NewRedirectPolicyFromFlags(c *cli.Command) *RedirectPolicy {
+	return &RedirectPolicy{NoFollow: c.Bool("no-follow"), Max: int(c.Uint("max-redirs"))}
+}
+
+// RedirectHop 是重定向链中的一跳
+type RedirectHop struct {
+	URL        string
+	StatusCode int
+	Location   string
+	// Duration 为发出该跳请求到收到响应头的耗时
+	Duration time.Duration
+}
+
+// redirectRecorder 在跟随重定向时记录每一跳的信息, 不跟随时记录返回的3xx响应
+type redirectRecorder struct {
+	policy RedirectPolicy
+	start  time.Time
+	hops   []RedirectHop
+}
+
+func newRedirectRecorder(policy RedirectPolicy) *redirectRecorder {
+	return &redirectRecorder{policy: policy, start: time.Now()}
+}
+
+// CheckRedirect 用作 http.Client.CheckRedirect, req.Response 为触发本次跳转的响应
+func (r *redirectRecorder) CheckRedirect(req *http.Request, via []*http.Request) error {
+	now := time.Now()
+	resp := req.Response
+	r.hops = append(r.hops, RedirectHop{
+		URL:        via[len(via)-1].URL.String(),
+		StatusCode: resp.StatusCode,
+		Location:   resp.Header.Get("Location"),
+		Duration:   now.Sub(r.start),
+	})
+	r.start = now
+
+	if r.policy.NoFollow {
+		return http.ErrUseLastResponse
+	}
+	// 同一URL可能在设置Cookie后再次跳转回来, 不按重复URL判断循环, 只限制跳转次数
+	if len(via) > r.policy.Max {
+		return fmt.Errorf("stopped after %d redirects", r.policy.Max)
+	}
+	return nil
+}
+
+// formatRedirects 将重定向链格式化为单行文本
+func formatRedirects(hops []RedirectHop) string {
+	parts := make([]string, 0, len(hops))
+	for _, h := range hops {
+		parts = append(parts, fmt.Sprintf("%d %s -> %s", h.StatusCode, h.URL, h.Location))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func printRedirects(w io.Writer, hops []RedirectHop) {
+	for i, h := range hops {
+		util.PrintToFile(w, "  [%d] %d %s -> %s (%v)\n", i+1, h.StatusCode, h.URL, h.Location, h.Duration.Round(time.Microsecond))
+	}
+}
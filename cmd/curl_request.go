@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+// 未指定请求头时使用的浏览器特征头
+var defaultHeaders = map[string]string{
+	"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+	"Accept":          "text/html,application/xhtml+xml",
+	"Accept-Language": "en-US,en;q=0.9",
+}
+
+// Request 描述一次HTTP请求, URL为空时作为模板应用到批量执行的每个URL上
+type Request struct {
+	// Index 是请求在输入中的位置, 从0开始
+	Index  int
+	URL    string
+	Method string
+	Header http.Header
+	Body   []byte
+	// Checksum 是下载模式下期望的校验值, 格式为 "算法:HEX"
+	Checksum string
+	// err 记录输入行的解析错误, 构造请求时返回
+	err error
+}
+
+func requestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "method",
+			Aliases: []string{"X"},
+			Usage:   "HTTP method to use (default GET, or POST when a body is given)",
+		},
+		&cli.StringSliceFlag{
+			Name:    "header",
+			Aliases: []string{"H"},
+			Usage:   "Extra header in 'Name: Value' form, can be repeated",
+		},
+		&cli.StringFlag{
+			Name:    "data",
+			Aliases: []string{"d"},
+			Usage:   "Request body. Use '@file' to read from a file or '@-' for stdin",
+		},
+		&cli.StringFlag{
+			Name:  "data-file",
+			Usage: "Read request body from the file. Use '-' for stdin",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Send body as JSON (sets Content-Type and Accept to application/json)",
+		},
+	}
+}
+
+// NewRequestFromFlags 根据命令行参数构造请求模板
+func NewRequestFromFlags(c *cli.Command) (req Request, err error) {
+	if c.IsSet("data") && c.IsSet("data-file") {
+		return req, fmt.Errorf("--data and --data-file cannot be used together")
+	}
+
+	if data := c.String("data"); data != "" {
+		req.Body, err = readBody(data)
+	} else if file := c.String("data-file"); file != "" {
+		req.Body, err = readBody("@" + file)
+	}
+	if err != nil {
+		return req, err
+	}
+
+	req.Header = http.Header{}
+	for _, h := range c.StringSlice("header") {
+		name, value, err := ParseHeader(h)
+		if err != nil {
+			return req, err
+		}
+		req.Header.Add(name, value)
+	}
+
+	if c.Bool("json") {
+		req.Header.Set("Content-Type", "application/json")
+		if req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", "application/json")
+		}
+	}
+
+	req.Method = strings.ToUpper(c.String("method"))
+	if req.Method == "" {
+		req.Method = http.MethodGet
+		if req.Body != nil {
+			req.Method = http.MethodPost
+		}
+	}
+
+	return req, nil
+}
+
+// ParseHeader 解析 'Name: Value' 形式的请求头
+func ParseHeader(h string) (name, value string, err error) {
+	name, value, ok := strings.Cut(h, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid header %q, expect 'Name: Value'", h)
+	}
+	return name, strings.TrimSpace(value), nil
+}
+
+// readBody 读取请求体, '@'开头表示从文件读取, '@-'表示从标准输入读取
+func readBody(data string) ([]byte, error) {
+	path, ok := strings.CutPrefix(data, "@")
+	if !ok {
+		return []byte(data), nil
+	}
+
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file: %w", err)
+	}
+	defer util.CloseWithLog(f)
+	return io.ReadAll(f)
+}
+
+// requestLine 是输入文件中JSON格式的单行请求描述
+type requestLine struct {
+	URL      string          `json:"url"`
+	Method   string          `json:"method"`
+	Headers  json.RawMessage `json:"headers"`
+	Body     json.RawMessage `json:"body"`
+	Checksum string          `json:"checksum"`
+}
+
+// ParseRequestLine 解析输入中的一行请求, 支持以下三种格式:
+//
+//	https://example.com                       使用模板的GET请求
+//	POST https://example.com                  使用模板并指定请求方法
+//	{"method":"POST","url":"...","headers":{"A":"b"},"body":"..."}
+//
+// 行内未指定的字段继承自模板, 请求头在模板基础上覆盖
+func ParseRequestLine(line string, template Request) (req Request, err error) {
+	req = template.Clone()
+
+	if IsCurlCommand(line) {
+		return ParseCurlCommand(line, template)
+	}
+
+	if strings.HasPrefix(line, "{") {
+		var spec requestLine
+		if err := json.Unmarshal([]byte(line), &spec); err != nil {
+			return req, fmt.Errorf("invalid request line %q: %w", line, err)
+		}
+		if spec.URL == "" {
+			return req, fmt.Errorf("invalid request line %q: url is required", line)
+		}
+		req.URL = spec.URL
+		if spec.Checksum != "" {
+			req.Checksum = spec.Checksum
+		}
+		if spec.Method != "" {
+			req.Method = strings.ToUpper(spec.Method)
+		}
+		if err := mergeHeaders(req.Header, spec.Headers); err != nil {
+			return req, fmt.Errorf("invalid request line %q: %w", line, err)
+		}
+		if len(spec.Body) > 0 && string(spec.Body) != "null" {
+			req.Body = decodeBody(spec.Body)
+			if spec.Method == "" && template.Method == http.MethodGet {
+				req.Method = http.MethodPost
+			}
+		}
+		return req, nil
+	}
+
+	if method, url, ok := strings.Cut(line, " "); ok && !strings.ContainsAny(method, ":/") {
+		req.Method = strings.ToUpper(method)
+		req.URL = strings.TrimSpace(url)
+		return req, nil
+	}
+
+	req.URL = line
+	return req, nil
+}
+
+// ParseRequestLineOrInvalid 解析一行请求, 解析失败时返回一个执行时报错的请求, 使错误出现在该行的结果中
+func ParseRequestLineOrInvalid(line string, template Request) Request {
+	req, err := ParseRequestLine(line, template)
+	if err != nil {
+		req = template.Clone()
+		req.URL = line
+		req.err = err
+	}
+	return req
+}
+
+// mergeHeaders 合并JSON中的请求头, 支持 {"Name":"Value"} 和 ["Name: Value"] 两种写法
+func mergeHeaders(header http.Header, raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var kv map[string]string
+	if err := json.Unmarshal(raw, &kv); err == nil {
+		for name, value := range kv {
+			header.Set(name, value)
+		}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("headers must be an object or a list of 'Name: Value'")
+	}
+	for _, h := range list {
+		name, value, err := ParseHeader(h)
+		if err != nil {
+			return err
+		}
+		header.Set(name, value)
+	}
+	return nil
+}
+
+// decodeBody 字符串类型的body按原文发送, 其他JSON值按JSON文本发送
+func decodeBody(raw json.RawMessage) []byte {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []byte(s)
+	}
+	return []byte(raw)
+}
+
+// Clone 复制请求, 避免多个请求共享同一个请求头
+func (r Request) Clone() Request {
+	r.Header = r.Header.Clone()
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	return r
+}
+
+// Build 根据请求描述创建HTTP请求, 每次调用都会生成独立的请求体
+func (r Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if r.Body != nil {
+		body = bytes.NewReader(r.Body)
+	}
+
+	req, err := http.NewRequest(method, r.URL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先设置默认头, 再用用户指定的头覆盖
+	for name, value := range defaultHeaders {
+		req.Header.Set(name, value)
+	}
+	for name, values := range r.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if host := r.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	return req, nil
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy 描述失败请求的重试策略
+type RetryPolicy struct {
+	// Max 最大重试次数, 0表示不重试
+	Max uint8
+	// OnNetwork 连接失败等网络错误时重试
+	OnNetwork bool
+	// OnTimeout 请求超时时重试
+	OnTimeout bool
+	// OnStatus 响应状态码命中时重试
+	OnStatus StatusMatcher
+	// OnStreamEnd 事件流被服务端正常关闭时重连
+	OnStreamEnd bool
+	// BaseDelay 首次重试前的等待时间, 之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 单次等待时间的上限, 同样作用于 Retry-After
+	MaxDelay time.Duration
+}
+
+// ParseRetryConditions 解析逗号分隔的重试条件, 例如 "network,timeout,429,5xx"
+func ParseRetryConditions(expr string, policy *RetryPolicy) error {
+	var codes []string
+	for _, item := range strings.Split(expr, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch item {
+		case "":
+		case "network":
+			policy.OnNetwork = true
+		case "timeout":
+			policy.OnTimeout = true
+		default:
+			codes = append(codes, item)
+		}
+	}
+
+	if len(codes) > 0 {
+		m, err := ParseStatusMatcher(strings.Join(codes, ","))
+		if err != nil {
+			return fmt.Errorf("invalid retry condition: %w", err)
+		}
+		policy.OnStatus = m
+	}
+	return nil
+}
+
+// ShouldRetry 判断一次请求结果是否需要重试
+func (p RetryPolicy) ShouldRetry(rst TaskRst) bool {
+	if rst.Err == nil && rst.Stream != nil && rst.Stream.Ended {
+		return p.OnStreamEnd
+	}
+	// 流式响应中断时已经收到状态码, 同样按网络错误或超时处理
+	if rst.Err != nil && (rst.StatusCode == 0 || rst.Stream != nil) {
+		if isTimeout(rst.Err) {
+			return p.OnTimeout
+		}
+		return p.OnNetwork
+	}
+	return p.OnStatus != nil && p.OnStatus.Match(rst.StatusCode)
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// Backoff 计算第attempt次重试前的等待时间, 使用指数退避并加入随机抖动
+// 如果响应包含 Retry-After 头或事件流指定了retry, 则优先使用服务端给出的等待时间
+func (p RetryPolicy) Backoff(attempt int, rst TaskRst) time.Duration {
+	if wait, ok := retryAfter(rst.Header); ok {
+		return min(wait, p.MaxDelay)
+	}
+	if rst.Stream != nil && rst.Stream.Retry > 0 {
+		return min(rst.Stream.Retry, p.MaxDelay)
+	}
+
+	delay := p.BaseDelay << min(attempt, 30)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// 保留一半的固定等待, 另一半随机, 避免大量请求同时重试
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(half)
+}
+
+// retryAfter 解析 Retry-After 头, 支持秒数和HTTP日期两种格式
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
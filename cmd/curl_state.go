@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+)
+
+// stateEntry 是状态文件中的一行, 记录一个已完成的请求
+type stateEntry struct {
+	Index   int       `json:"index"`
+	Method  string    `json:"method"`
+	URL     string    `json:"url"`
+	Status  int       `json:"status,omitempty"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// StateFile 以JSONL格式增量记录已完成的请求, 用于中断后继续执行
+type StateFile struct {
+	f    *os.File
+	done map[int]string
+}
+
+func stateKey(method, url string) string {
+	return method + " " + url
+}
+
+// OpenStateFile 打开状态文件, resume为true时加载已有记录并追加, 否则清空重新记录
+func OpenStateFile(path string, resume bool) (*StateFile, error) {
+	s := &StateFile{done: map[int]string{}}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flag = os.O_CREATE | os.O_RDWR | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+	s.f = f
+
+	if resume {
+		if err := s.load(); err != nil {
+			util.CloseWithLog(f)
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// load 读取已有记录, 进程崩溃时最后一行可能不完整, 解析失败的行直接忽略
+func (s *StateFile) load() error {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var last byte = '\n'
+	reader := bufio.NewReader(s.f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			last = line[len(line)-1]
+			var e stateEntry
+			if json.Unmarshal(line, &e) == nil {
+				s.done[e.Index] = stateKey(e.Method, e.URL)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read state file: %w", err)
+		}
+	}
+
+	// 保证后续追加的记录从新的一行开始
+	if last != '\n' {
+		if _, err := s.f.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Done 判断请求在之前的运行中是否已经完成, 需要输入中的位置和请求内容都一致
+func (s *StateFile) Done(r Request) bool {
+	key, ok := s.done[r.Index]
+	return ok && key == stateKey(r.Method, r.URL)
+}
+
+// Count 返回已完成的请求数
+func (s *StateFile) Count() int {
+	return len(s.done)
+}
+
+// Record 追加一条完成记录
+func (s *StateFile) Record(rst TaskRst) {
+	e := stateEntry{
+		Index:   rst.Index,
+		Method:  rst.Method,
+		URL:     rst.URL,
+		Status:  rst.StatusCode,
+		Success: rst.Err == nil,
+		Time:    time.Now(),
+	}
+	if rst.Err != nil {
+		e.Error = rst.Err.Error()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	util.PrintToFile(s.f, "%s\n", data)
+}
+
+func (s *StateFile) Close() error {
+	return s.f.Close()
+}
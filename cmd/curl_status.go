@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// statusRange 表示一个闭区间的状态码范围
+type statusRange struct {
+	low, high int
+}
+
+// StatusMatcher 判断状态码是否符合预期, 例如 "2xx,304"
+type StatusMatcher []statusRange
+
+// ParseStatusMatcher 解析逗号分隔的状态码列表, 支持 2xx 形式的状态码类别
+func ParseStatusMatcher(expr string) (StatusMatcher, error) {
+	var m StatusMatcher
+	for _, item := range strings.Split(expr, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+
+		if len(item) == 3 && strings.HasSuffix(item, "xx") && item[0] >= '1' && item[0] <= '5' {
+			class := int(item[0]-'0') * 100
+			m = append(m, statusRange{class, class + 99})
+			continue
+		}
+
+		code, err := strconv.Atoi(item)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status %q, expect a code like 200 or a class like 2xx", item)
+		}
+		m = append(m, statusRange{code, code})
+	}
+
+	if len(m) == 0 {
+		return nil, fmt.Errorf("empty status expectation")
+	}
+	return m, nil
+}
+
+// Match 状态码在任意一个范围内即视为匹配
+func (m StatusMatcher) Match(code int) bool {
+	for _, r := range m {
+		if code >= r.low && code <= r.high {
+			return true
+		}
+	}
+	return false
+}
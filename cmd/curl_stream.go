@@ -0,0 +1,414 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+func streamFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "stream",
+			Usage: "Print the response body as it arrives instead of waiting for the end; text/event-stream bodies are printed as events",
+		},
+		&cli.BoolFlag{
+			Name:  "sse",
+			Usage: "Parse the body as Server-Sent Events regardless of Content-Type (implies --stream)",
+		},
+		&cli.StringFlag{
+			Name:  "last-event-id",
+			Usage: "Last-Event-ID sent with the first request of each stream",
+		},
+		&cli.Uint8Flag{
+			Name:  "reconnect",
+			Usage: "Reconnect a broken stream, or an event stream closed by the server, up to N times, resuming from the last received event id",
+		},
+		&cli.DurationFlag{
+			Name:  "idle-timeout",
+			Value: time.Minute,
+			Usage: "Abort a stream when no data arrives within the duration (0 means no limit). --timeout only limits waiting for headers",
+		},
+	}
+}
+
+// Streamer 在接收响应体的同时输出数据, 事件流按SSE格式解析为事件
+// 同一个请求重连时累计统计, 并通过 Last-Event-ID 从上次收到的事件继续
+type Streamer struct {
+	// SSE 为true时总是按事件流解析, 否则只解析 text/event-stream 响应
+	SSE bool
+	// LastEventID 是每个请求首次发送时使用的 Last-Event-ID
+	LastEventID string
+
+	mu      sync.Mutex
+	w       io.Writer
+	streams map[int]*StreamStats
+}
+
+// StreamStats 记录一个流式请求的接收情况, 非事件流时每次收到的数据块计为一个事件
+type StreamStats struct {
+	URL    string
+	Events int
+	Bytes  int64
+	// FirstEvent 是从首次发出请求到收到第一个事件的时间, 包含重连的耗时
+	FirstEvent  time.Duration
+	LastEventID string
+	// Retry 是服务端通过retry字段指定的重连间隔
+	Retry      time.Duration
+	Reconnects int
+	// Ended 为true表示事件流被服务端正常关闭, 按SSE的约定可以重连
+	Ended bool
+
+	start time.Time
+}
+
+// NewStreamerFromFlags 根据 --stream 和 --sse 创建Streamer, 未开启时返回nil
+func NewStreamerFromFlags(c *cli.Command, w io.Writer) *Streamer {
+	if !c.Bool("stream") && !c.Bool("sse") {
+		return nil
+	}
+	return &Streamer{
+		SSE:         c.Bool("sse"),
+		LastEventID: c.String("last-event-id"),
+		w:           w,
+		streams:     map[int]*StreamStats{},
+	}
+}
+
+// Prepare 重连时携带最后收到的事件ID
+func (s *Streamer) Prepare(r Request, req *http.Request) error {
+	s.mu.Lock()
+	st, ok := s.streams[r.Index]
+	if ok {
+		st.Reconnects++
+		st.Ended = false
+	} else {
+		st = &StreamStats{URL: r.URL, LastEventID: s.LastEventID, start: time.Now()}
+		s.streams[r.Index] = st
+	}
+	id := st.LastEventID
+	s.mu.Unlock()
+
+	if id != "" {
+		req.Header.Set("Last-Event-ID", id)
+	}
+	if s.SSE {
+		if req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+	return nil
+}
+
+// Consume 逐块读取响应体并输出, 不保留响应内容, 错误响应按普通响应读取
+func (s *Streamer) Consume(r Request, resp *http.Response, rst *TaskRst) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, err := io.ReadAll(resp.Body)
+		rst.Size = int64(len(data))
+		rst.Data = string(data)
+		return err
+	}
+
+	s.mu.Lock()
+	st := s.streams[r.Index]
+	s.mu.Unlock()
+
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if s.SSE || mediaType == "text/event-stream" {
+		err = s.readEvents(resp.Body, st)
+	} else {
+		err = s.readChunks(resp.Body, st)
+	}
+
+	s.mu.Lock()
+	stats := *st
+	s.mu.Unlock()
+	rst.Stream = &stats
+	rst.Size = stats.Bytes
+	return err
+}
+
+// readChunks 原样输出收到的每块数据
+func (s *Streamer) readChunks(body io.Reader, st *StreamStats) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			st.Bytes += int64(n)
+			s.received(st)
+			_, _ = s.w.Write(buf[:n])
+			s.mu.Unlock()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sseEvent 是一个已解析的事件
+type sseEvent struct {
+	Event string
+	ID    string
+	Data  string
+}
+
+// readEvents 按 WHATWG HTML 规范解析事件流, 每遇到一个空行分发一个事件, 流结束时未完成的事件被丢弃
+func (s *Streamer) readEvents(body io.Reader, st *StreamStats) error {
+	counter := &countingReader{r: body}
+	scanner := bufio.NewScanner(counter)
+	scanner.Buffer(make([]byte, 64*1024), wsMaxMessageSize)
+	scanner.Split(scanSSELines)
+
+	s.mu.Lock()
+	lastID, base := st.LastEventID, st.Bytes
+	s.mu.Unlock()
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		s.mu.Lock()
+		st.Bytes = base + counter.n
+		s.mu.Unlock()
+
+		if line == "" {
+			if data != nil {
+				s.dispatch(st, sseEvent{Event: event, ID: lastID, Data: strings.Join(data, "\n")})
+			} else {
+				// 只有id的事件不输出, 但同样更新重连时使用的 Last-Event-ID
+				s.mu.Lock()
+				st.LastEventID = lastID
+				s.mu.Unlock()
+			}
+			event, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// 注释行通常用作心跳
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				s.mu.Lock()
+				st.Retry = time.Duration(ms) * time.Millisecond
+				s.mu.Unlock()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	st.Ended = true
+	s.mu.Unlock()
+	return nil
+}
+
+// dispatch 输出一个事件, 输出行以相对首次请求的时间开头
+func (s *Streamer) dispatch(st *StreamStats, ev sseEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.LastEventID = ev.ID
+	s.received(st)
+
+	name := ev.Event
+	if name == "" {
+		name = "message"
+	}
+	id := ""
+	if ev.ID != "" {
+		id = " id=" + ev.ID
+	}
+	elapsed := time.Since(st.start).Round(time.Millisecond)
+	util.PrintToFile(s.w, "[+%v] %s%s: %s\n", elapsed, name, id, strings.ReplaceAll(ev.Data, "\n", "\n  "))
+}
+
+// received 记录收到一个事件, 调用时需要持有锁
+func (s *Streamer) received(st *StreamStats) {
+	if st.Events == 0 {
+		st.FirstEvent = time.Since(st.start)
+	}
+	st.Events++
+}
+
+// scanSSELines 按 CRLF, LF 或 CR 分割行
+func scanSSELines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// 单独的CR也是行尾, 需要确认后面是否紧跟LF
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Print 输出每个流的统计和首个事件耗时的分位数
+func (s *Streamer) Print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	indexes := make([]int, 0, len(s.streams))
+	for index := range s.streams {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+
+	util.PrintToFile(w, "Stream summary for %d requests\n", len(indexes))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	util.PrintToFile(tw, "url\tevents\tbytes\tfirst_event\treconnects\tlast_event_id\n")
+	var firsts []time.Duration
+	for _, index := range indexes {
+		st := s.streams[index]
+		first := "-"
+		if st.Events > 0 {
+			first = roundMs(st.FirstEvent).String()
+			firsts = append(firsts, st.FirstEvent)
+		}
+		util.PrintToFile(tw, "%s\t%d\t%d\t%s\t%d\t%s\n", st.URL, st.Events, st.Bytes, first, st.Reconnects, st.LastEventID)
+	}
+	if err := tw.Flush(); err != nil {
+		panic(err)
+	}
+
+	if len(firsts) > 1 {
+		slices.Sort(firsts)
+		util.PrintToFile(w, "Time to first event: min=%v p50=%v p90=%v p99=%v max=%v\n",
+			roundMs(firsts[0]), roundMs(Percentile(firsts, 50)), roundMs(Percentile(firsts, 90)),
+			roundMs(Percentile(firsts, 99)), roundMs(firsts[len(firsts)-1]))
+	}
+}
+
+// streamDeadline 在收到响应头前限制等待时间, 收到响应头后限制两次读取的间隔
+// 流式响应可能持续很久, 不能使用 http.Client 的总超时
+type streamDeadline struct {
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	timer     *time.Timer
+	idle      time.Duration
+	reading   atomic.Bool
+	headerErr error
+	idleErr   error
+}
+
+func newStreamDeadline(ctx context.Context, header, idle time.Duration) (context.Context, *streamDeadline) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	d := &streamDeadline{
+		ctx:       ctx,
+		cancel:    cancel,
+		idle:      idle,
+		headerErr: fmt.Errorf("timeout awaiting response headers after %v: %w", header, context.DeadlineExceeded),
+		idleErr:   fmt.Errorf("no data received for %v: %w", idle, context.DeadlineExceeded),
+	}
+	if header > 0 {
+		d.timer = time.AfterFunc(header, d.fire)
+	}
+	return ctx, d
+}
+
+func (d *streamDeadline) fire() {
+	if d.reading.Load() {
+		d.cancel(d.idleErr)
+	} else {
+		d.cancel(d.headerErr)
+	}
+}
+
+func (d *streamDeadline) reset() {
+	switch {
+	case d.idle <= 0:
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+	case d.timer == nil:
+		d.timer = time.AfterFunc(d.idle, d.fire)
+	default:
+		d.timer.Reset(d.idle)
+	}
+}
+
+// Wrap 在收到响应头后调用, 之后每次读取响应体都重新开始计时
+func (d *streamDeadline) Wrap(body io.ReadCloser) io.ReadCloser {
+	d.reading.Store(true)
+	d.reset()
+	return &idleBody{ReadCloser: body, d: d}
+}
+
+// Stop 停止计时, 超时导致的错误替换为可读的超时原因
+func (d *streamDeadline) Stop(err error) error {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	cause := context.Cause(d.ctx)
+	d.cancel(nil)
+	if err != nil && (cause == d.headerErr || cause == d.idleErr) {
+		return cause
+	}
+	return err
+}
+
+type idleBody struct {
+	io.ReadCloser
+	d *streamDeadline
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.d.reset()
+	return n, err
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+)
+
+// Timing 记录一次请求各阶段的耗时, 复用连接时DNS/Connect/TLS为0
+type Timing struct {
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	TTFB     time.Duration
+	Transfer time.Duration
+}
+
+// timingTracer 通过httptrace收集各阶段的时间点
+type timingTracer struct {
+	mu                     sync.Mutex
+	dnsStart, dnsDone      time.Time
+	connStart, connDone    time.Time
+	tlsStart, tlsDone      time.Time
+	wroteRequest           time.Time
+	firstByte, transferEnd time.Time
+}
+
+func (t *timingTracer) mark(p *time.Time, overwrite bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// 多地址拨号时会多次回调, 开始时间取第一次, 结束时间取最后一次
+	if overwrite || p.IsZero() {
+		*p = time.Now()
+	}
+}
+
+// WithContext 将tracer挂载到context上
+func (t *timingTracer) WithContext(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart, false) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone, true) },
+		ConnectStart:         func(string, string) { t.mark(&t.connStart, false) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connDone, true) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart, false) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone, true) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest, true) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte, true) },
+	})
+}
+
+// Done 标记响应体读取完毕
+func (t *timingTracer) Done() {
+	t.mark(&t.transferEnd, true)
+}
+
+func span(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// Timing 计算各阶段耗时
+func (t *timingTracer) Timing() *Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &Timing{
+		DNS:      span(t.dnsStart, t.dnsDone),
+		Connect:  span(t.connStart, t.connDone),
+		TLS:      span(t.tlsStart, t.tlsDone),
+		TTFB:     span(t.wroteRequest, t.firstByte),
+		Transfer: span(t.firstByte, t.transferEnd),
+	}
+}
+
+func (t *Timing) String() string {
+	return fmt.Sprintf("dns=%v connect=%v tls=%v ttfb=%v transfer=%v",
+		t.DNS.Round(time.Microsecond), t.Connect.Round(time.Microsecond), t.TLS.Round(time.Microsecond),
+		t.TTFB.Round(time.Microsecond), t.Transfer.Round(time.Microsecond))
+}
+
+// Percentile 计算已排序样本的p分位数(0-100)
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p/100*float64(len(sorted)) + 0.5)
+	idx = min(max(idx-1, 0), len(sorted)-1)
+	return sorted[idx]
+}
+
+// TimingStats 汇总多个请求的阶段耗时
+type TimingStats struct {
+	phases [6][]time.Duration
+}
+
+var timingPhaseNames = [6]string{"dns", "connect", "tls", "ttfb", "transfer", "total"}
+
+// Add 添加一个请求结果, 没有耗时信息的结果会被忽略
+func (s *TimingStats) Add(rst TaskRst) {
+	t := rst.Timing
+	if t == nil {
+		return
+	}
+	for i, d := range []time.Duration{t.DNS, t.Connect, t.TLS, t.TTFB, t.Transfer, rst.Duration} {
+		s.phases[i] = append(s.phases[i], d)
+	}
+}
+
+// Print 输出每个阶段的 p50/p90/p99 分位数
+func (s *TimingStats) Print(w io.Writer) {
+	count := len(s.phases[0])
+	util.PrintToFile(w, "Timing statistics for %d requests\n", count)
+	if count == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	util.PrintToFile(tw, "phase\tmin\tp50\tp90\tp99\tmax\t\n")
+	for i, samples := range s.phases {
+		sorted := slices.Clone(samples)
+		slices.Sort(sorted)
+		util.PrintToFile(tw, "%s\t%v\t%v\t%v\t%v\t%v\t\n", timingPhaseNames[i],
+			roundMs(sorted[0]), roundMs(Percentile(sorted, 50)), roundMs(Percentile(sorted, 90)),
+			roundMs(Percentile(sorted, 99)), roundMs(sorted[len(sorted)-1]))
+	}
+	if err := tw.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+func roundMs(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// TransportOptions 控制批量请求共享的连接池和协议
+type TransportOptions struct {
+	MaxIdleConnsPerHost int
+	DisableKeepAlives   bool
+	// Protocol 可选 http1.1, http2, h2c, 为空时自动协商
+	Protocol string
+	// TLS 为空时使用默认TLS配置
+	TLS *tls.Config
+	// Proxy 为空时使用环境变量中的代理, NoProxy 中的Host始终直连
+	Proxy   string
+	NoProxy string
+	// AddrMap 在拨号时替换目标地址
+	AddrMap AddrMap
+}
+
+func transportFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "max-idle-per-host",
+			Value: 100,
+			Usage: "Maximum idle (keep-alive) connections kept per host",
+		},
+		&cli.BoolFlag{
+			Name:  "no-keepalive",
+			Usage: "Disable keep-alive, open a new connection for every request",
+		},
+		&cli.StringFlag{
+			Name:  "proto",
+			Usage: "Force protocol: http1.1, http2 (over TLS) or h2c (HTTP/2 without TLS)",
+		},
+		&cli.StringFlag{
+			Name:  "cacert",
+			Usage: "PEM file with CA certificates used to verify the server",
+		},
+		&cli.StringFlag{
+			Name:  "cert",
+			Usage: "PEM client certificate for mutual TLS",
+		},
+		&cli.StringFlag{
+			Name:  "key",
+			Usage: "PEM private key for --cert (defaults to the --cert file)",
+		},
+		&cli.BoolFlag{
+			Name:    "insecure",
+			Aliases: []string{"k"},
+			Usage:   "Skip server certificate verification",
+		},
+		&cli.StringFlag{
+			Name:  "sni",
+			Usage: "Server name sent in TLS handshake and used for verification",
+		},
+		&cli.StringFlag{
+			Name:  "tls-min",
+			Usage: "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3",
+		},
+		&cli.StringFlag{
+			Name:  "tls-max",
+			Usage: "Maximum TLS version: 1.0, 1.1, 1.2 or 1.3",
+		},
+		&cli.StringFlag{
+			Name:    "proxy",
+			Aliases: []string{"x"},
+			Usage:   "Proxy URL: http://, https:// or socks5://[user:pass@]host:port",
+		},
+		&cli.StringFlag{
+			Name:  "noproxy",
+			Usage: "Comma separated hosts, domains or CIDRs that bypass the proxy, '*' for all",
+		},
+		&cli.StringSliceFlag{
+			Name:  "resolve",
+			Usage: "Connect to addr for host:port, in host:port:addr form, can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "connect-to",
+			Usage: "Connect to host2:port2 for host1:port1, in host1:port1:host2:port2 form, can be repeated",
+		},
+	}
+}
+
+// NewTransportOptionsFromFlags 根据命令行参数构造连接参数
+func NewTransportOptionsFromFlags(c *cli.Command) (TransportOptions, error) {
+	opts := TransportOptions{
+		MaxIdleConnsPerHost: c.Int("max-idle-per-host"),
+		DisableKeepAlives:   c.Bool("no-keepalive"),
+		Protocol:            c.String("proto"),
+		Proxy:               c.String("proxy"),
+		NoProxy:             c.String("noproxy"),
+		AddrMap:             AddrMap{},
+	}
+
+	for _, entry := range c.StringSlice("resolve") {
+		if err := opts.AddrMap.AddResolve(entry); err != nil {
+			return opts, err
+		}
+	}
+	for _, entry := range c.StringSlice("connect-to") {
+		if err := opts.AddrMap.AddConnectTo(entry); err != nil {
+			return opts, err
+		}
+	}
+
+	tlsConfig, err := newTLSConfigFromFlags(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.TLS = tlsConfig
+	return opts, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	if v == "" {
+		return 0, nil
+	}
+	version, ok := tlsVersions[v]
+	if !ok {
+		return 0, fmt.Errorf("invalid TLS version %q. Use 1.0, 1.1, 1.2 or 1.3", v)
+	}
+	return version, nil
+}
+
+// newTLSConfigFromFlags 根据命令行参数构造TLS配置, 未指定任何TLS参数时返回nil
+func newTLSConfigFromFlags(c *cli.Command) (*tls.Config, error) {
+	names := []string{"cacert", "cert", "key", "insecure", "sni", "tls-min", "tls-max"}
+	set := false
+	for _, name := range names {
+		set = set || c.IsSet(name)
+	}
+	if !set {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.Bool("insecure"),
+		ServerName:         c.String("sni"),
+	}
+
+	var err error
+	if cfg.MinVersion, err = parseTLSVersion(c.String("tls-min")); err != nil {
+		return nil, err
+	}
+	if cfg.MaxVersion, err = parseTLSVersion(c.String("tls-max")); err != nil {
+		return nil, err
+	}
+
+	if caFile := c.String("cacert"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	certFile, keyFile := c.String("cert"), c.String("key")
+	if keyFile != "" && certFile == "" {
+		return nil, fmt.Errorf("--key requires --cert")
+	}
+	if certFile != "" {
+		if keyFile == "" {
+			keyFile = certFile
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// NewTransport 创建在一次批量执行中共享的Transport, 以复用连接
+func NewTransport(opts TransportOptions) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	proxy, err := NewProxyFunc(opts.Proxy, opts.NoProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           opts.AddrMap.WrapDial(dialer.DialContext),
+		MaxIdleConns:          0,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableKeepAlives:     opts.DisableKeepAlives,
+		ForceAttemptHTTP2:     true,
+		TLSClientConfig:       opts.TLS,
+	}
+
+	protocols := new(http.Protocols)
+	switch opts.Protocol {
+	case "":
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	case "http1.1", "http1", "h1":
+		protocols.SetHTTP1(true)
+	case "http2", "h2":
+		protocols.SetHTTP2(true)
+	case "h2c":
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("invalid protocol %q. Use http1.1, http2 or h2c", opts.Protocol)
+	}
+	t.Protocols = protocols
+
+	return t, nil
+}
@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func GrpcCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "grpc",
+		Usage:     "List gRPC services or call unary methods with JSON messages, over gRPC or gRPC-web",
+		ArgsUsage: "TARGET [METHOD]",
+		// 可重复的参数不按逗号拆分, 元数据中可能包含逗号
+		DisableSliceFlagSeparator: true,
+		Arguments: []cli.Argument{
+			&cli.StringArg{
+				Name: "target",
+			},
+			&cli.StringArg{
+				Name: "method",
+			},
+		},
+		Flags: append([]cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "header",
+				Aliases: []string{"H"},
+				Usage:   "Request metadata in 'Name: Value' form, can be repeated",
+			},
+			&cli.StringFlag{
+				Name:    "data",
+				Aliases: []string{"d"},
+				Usage:   "Request message in JSON (default {}). Use '@file' to read from a file or '@-' for stdin",
+			},
+			&cli.StringFlag{
+				Name:    "input",
+				Aliases: []string{"i"},
+				Usage:   "File with one JSON request message per line, each line is a separate call. Use '-' for stdin",
+			},
+			&cli.StringSliceFlag{
+				Name:  "protoset",
+				Usage: "FileDescriptorSet file (protoc --include_imports -o) used instead of server reflection, can be repeated",
+			},
+			&cli.BoolFlag{
+				Name:  "plaintext",
+				Usage: "Use HTTP/2 without TLS (h2c) for a TARGET without scheme",
+			},
+			&cli.BoolFlag{
+				Name:  "web",
+				Usage: "Use the gRPC-web protocol, e.g. through Envoy or a grpc-web proxy",
+			},
+			&cli.BoolFlag{
+				Name:  "describe",
+				Usage: "Show the signature and message fields of METHOD instead of calling it",
+			},
+			&cli.Uint16Flag{
+				Name:    "concurrency",
+				Aliases: []string{"c"},
+				Value:   50,
+				Usage:   "Maximum number of concurrent calls",
+			},
+			&cli.Uint8Flag{
+				Name:    "timeout",
+				Aliases: []string{"t"},
+				Value:   10,
+				Usage:   "Timeout in seconds for each call, also sent as grpc-timeout",
+			},
+			&cli.BoolFlag{
+				Name:  "ordered",
+				Usage: "Output results in input order instead of completion order",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"F"},
+				Value:   "text",
+				Usage:   "Output format: text, json, jsonl, csv or table",
+			},
+			&cli.BoolFlag{
+				Name:  "pretty",
+				Usage: "Pretty-print response messages",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Write results to the specified file",
+			},
+		}, transportFlags()...),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			target, method := c.StringArg("target"), c.StringArg("method")
+			if target == "" {
+				return fmt.Errorf("no target provided. Usage: gmh grpc [options] TARGET [METHOD]")
+			}
+			web := c.Bool("web")
+			baseURL, plaintext := grpcBaseURL(target, c.Bool("plaintext"))
+
+			header := http.Header{}
+			for _, h := range c.StringSlice("header") {
+				name, value, err := ParseHeader(h)
+				if err != nil {
+					return err
+				}
+				header.Add(name, value)
+			}
+
+			// gRPC需要HTTP/2, 明文连接使用h2c, gRPC-web可以使用任意协议
+			transportOptions, err := NewTransportOptionsFromFlags(c)
+			if err != nil {
+				return err
+			}
+			if transportOptions.Protocol == "" && !web {
+				transportOptions.Protocol = "http2"
+				if plaintext {
+					transportOptions.Protocol = "h2c"
+				}
+			}
+			transport, err := NewTransport(transportOptions)
+			if err != nil {
+				return err
+			}
+			defer transport.CloseIdleConnections()
+			timeout := time.Duration(c.Uint8("timeout")) * time.Second
+
+			// 准备服务定义
+			var files *protoregistry.Files
+			var services []string
+			if protosets := c.StringSlice("protoset"); len(protosets) > 0 {
+				if files, err = LoadProtosets(protosets); err != nil {
+					return err
+				}
+				files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+					for i := range fd.Services().Len() {
+						services = append(services, string(fd.Services().Get(i).FullName()))
+					}
+					return true
+				})
+			} else {
+				reflection := &ReflectionClient{
+					Client:  &http.Client{Transport: transport, Timeout: timeout},
+					BaseURL: baseURL,
+					Web:     web,
+					Header:  header,
+					Timeout: timeout,
+				}
+				if method != "" {
+					services = []string{grpcServiceOf(method)}
+				} else if services, err = reflection.ListServices(ctx); err != nil {
+					return err
+				}
+				if files, err = reflection.Files(ctx, services); err != nil {
+					return err
+				}
+			}
+
+			if method == "" {
+				PrintGrpcServices(os.Stdout, files, services)
+				return nil
+			}
+			md, err := FindGrpcMethod(files, method)
+			if err != nil {
+				return err
+			}
+			if c.Bool("describe") {
+				DescribeGrpcMethod(os.Stdout, md)
+				return nil
+			}
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				return fmt.Errorf("%s is a streaming method, only unary methods are supported", md.FullName())
+			}
+
+			// 准备输出
+			var writer io.Writer = os.Stdout
+			if outputFile := c.String("output"); outputFile != "" {
+				f, err := os.Create(outputFile)
+				if err != nil {
+					return err
+				}
+				defer util.CloseWithLog(f)
+				writer = f
+			}
+			rw, err := NewResultWriter(c.String("format"), writer, OutputOptions{
+				Body: BodyRender{Pretty: c.Bool("pretty")},
+			})
+			if err != nil {
+				return err
+			}
+
+			codec := &GrpcCodec{Method: md, Web: web, Types: dynamicpb.NewTypes(files)}
+			callURL := baseURL + "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+			var inputErr error
+			requests := func(yield func(Request) bool) {
+				for index, message := range grpcMessages(c) {
+					if message.err != nil {
+						inputErr = message.err
+						return
+					}
+					// 无法编码的消息作为该次调用的错误输出, 不影响其他调用
+					request := NewGrpcRequest(callURL, web, header, timeout)
+					request.Index = index
+					request.Body, request.err = codec.Encode(message.data)
+					if !yield(request) {
+						return
+					}
+				}
+			}
+
+			task := Task{
+				Requests:    requests,
+				Concurrency: c.Uint16("concurrency"),
+				Ordered:     c.Bool("ordered"),
+				CurlOptions: CurlOptions{
+					Timeout:   c.Uint8("timeout"),
+					Transport: transport,
+					Body:      codec,
+				},
+			}
+
+			count, failCount := 0, 0
+			for rst := range DoCurlTask(ctx, task) {
+				count++
+				if rst.Err != nil {
+					failCount++
+				}
+				rw.Write(rst)
+			}
+			rw.Flush()
+			if inputErr != nil {
+				return inputErr
+			}
+			if failCount > 0 {
+				return fmt.Errorf("%d of %d calls failed", failCount, count)
+			}
+			return nil
+		},
+	}
+}
+
+// grpcBaseURL 将TARGET转换为URL, 没有scheme时默认使用TLS, plaintext为true时使用明文
+func grpcBaseURL(target string, plaintext bool) (baseURL string, isPlaintext bool) {
+	switch {
+	case strings.HasPrefix(target, "http://"):
+		plaintext = true
+	case strings.HasPrefix(target, "https://"):
+		plaintext = false
+	case plaintext:
+		target = "http://" + target
+	default:
+		target = "https://" + target
+	}
+	return strings.TrimSuffix(target, "/"), plaintext
+}
+
+// grpcMessage 是一条待发送的JSON请求
+type grpcMessage struct {
+	data []byte
+	err  error
+}
+
+// grpcMessages 依次返回 --input 中的每一行, 未指定时返回 --data 或空消息
+func grpcMessages(c *cli.Command) iter.Seq2[int, grpcMessage] {
+	return func(yield func(int, grpcMessage) bool) {
+		if file := c.String("input"); file != "" {
+			index := 0
+			for line, err := range util.StreamFileInput(file) {
+				if !yield(index, grpcMessage{data: []byte(line), err: err}) || err != nil {
+					return
+				}
+				index++
+			}
+			return
+		}
+
+		data := []byte("{}")
+		if d := c.String("data"); d != "" {
+			var err error
+			if data, err = readBody(d); err != nil {
+				yield(0, grpcMessage{err: err})
+				return
+			}
+		}
+		yield(0, grpcMessage{data: data})
+	}
+}
+
+// GrpcCodec 在JSON和方法的protobuf消息之间转换, 同时作为 DoCurlTask 的 BodyHandler 解析响应
+type GrpcCodec struct {
+	Method protoreflect.MethodDescriptor
+	Web    bool
+	// Types 用于解析 google.protobuf.Any 中的类型
+	Types *dynamicpb.Types
+}
+
+// Encode 将JSON请求转换为编码后的请求体
+func (g *GrpcCodec) Encode(data []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(g.Method.Input())
+	if err := (protojson.UnmarshalOptions{Resolver: g.Types}).Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("invalid %s message: %w", g.Method.Input().FullName(), err)
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return grpcFrame(0, b), nil
+}
+
+func (g *GrpcCodec) Prepare(Request, *http.Request) error {
+	return nil
+}
+
+// Consume 读取响应消息并转换为JSON, 非OK状态作为请求的错误
+func (g *GrpcCodec) Consume(_ Request, resp *http.Response, rst *TaskRst) error {
+	messages, err := ReadGrpcResponse(resp, g.Web)
+	for _, msg := range messages {
+		rst.Size += int64(len(msg))
+	}
+	if err != nil {
+		return err
+	}
+	if len(messages) != 1 {
+		return fmt.Errorf("expect 1 response message, got %d", len(messages))
+	}
+
+	msg := dynamicpb.NewMessage(g.Method.Output())
+	if err := proto.Unmarshal(messages[0], msg); err != nil {
+		return fmt.Errorf("invalid %s message: %w", g.Method.Output().FullName(), err)
+	}
+	data, err := protojson.MarshalOptions{Resolver: g.Types}.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	// protojson的输出会随机加入空格, 压缩后保证输出稳定
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return err
+	}
+	rst.Data = buf.String()
+	return nil
+}
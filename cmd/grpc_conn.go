@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// grpcCodeNames 是gRPC状态码的名称, 下标即状态码
+var grpcCodeNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION", "ABORTED",
+	"OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+const grpcUnimplemented = 12
+
+// grpcMaxMessageSize 是单个响应消息的最大长度, 防止异常数据耗尽内存
+const grpcMaxMessageSize = 64 << 20
+
+// GrpcError 是服务端返回的非OK状态
+type GrpcError struct {
+	Code    int
+	Message string
+}
+
+func (e *GrpcError) Error() string {
+	name := strconv.Itoa(e.Code)
+	if e.Code >= 0 && e.Code < len(grpcCodeNames) {
+		name = grpcCodeNames[e.Code]
+	}
+	if e.Message == "" {
+		return "grpc status " + name
+	}
+	return fmt.Sprintf("grpc status %s: %s", name, e.Message)
+}
+
+// NewGrpcRequest 构造一次gRPC调用, 每个消息按长度前缀编码后依次写入请求体
+// web为true时使用gRPC-web协议, 可以通过HTTP/1.1发送
+func NewGrpcRequest(rawURL string, web bool, header http.Header, timeout time.Duration, messages ...[]byte) Request {
+	r := Request{URL: rawURL, Method: http.MethodPost, Header: header.Clone()}
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	if web {
+		r.Header.Set("Content-Type", "application/grpc-web+proto")
+		r.Header.Set("X-Grpc-Web", "1")
+	} else {
+		r.Header.Set("Content-Type", "application/grpc")
+		r.Header.Set("TE", "trailers")
+	}
+	r.Header.Set("Accept", r.Header.Get("Content-Type"))
+	if r.Header.Get("User-Agent") == "" {
+		r.Header.Set("User-Agent", "gmh-grpc")
+	}
+	if timeout > 0 {
+		r.Header.Set("Grpc-Timeout", fmt.Sprintf("%dm", timeout.Milliseconds()))
+	}
+
+	var body bytes.Buffer
+	for _, msg := range messages {
+		body.Write(grpcFrame(0, msg))
+	}
+	r.Body = body.Bytes()
+	return r
+}
+
+// grpcFrame 编码一个消息帧: 1字节标志位, 4字节大端长度, 然后是消息内容
+func grpcFrame(flag byte, msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// ReadGrpcResponse 读取响应中的全部消息并检查 grpc-status
+// 普通gRPC的状态在HTTP trailer中, 没有消息时也可能在响应头中, gRPC-web的状态在标志位为0x80的帧中
+func ReadGrpcResponse(resp *http.Response, web bool) (messages [][]byte, err error) {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, grpcMaxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > grpcMaxMessageSize {
+		return nil, fmt.Errorf("response too large")
+	}
+
+	trailer := resp.Trailer.Clone()
+	if trailer == nil {
+		trailer = http.Header{}
+	}
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, fmt.Errorf("truncated grpc frame")
+		}
+		flag, n := data[0], binary.BigEndian.Uint32(data[1:5])
+		if uint64(len(data)-5) < uint64(n) {
+			return nil, fmt.Errorf("truncated grpc frame")
+		}
+		payload := data[5 : 5+n]
+		data = data[5+n:]
+		switch {
+		case web && flag&0x80 != 0:
+			parseGrpcWebTrailer(payload, trailer)
+		case flag&0x01 != 0:
+			return nil, fmt.Errorf("compressed grpc messages are not supported")
+		default:
+			messages = append(messages, payload)
+		}
+	}
+
+	status := trailer.Get("Grpc-Status")
+	message := trailer.Get("Grpc-Message")
+	if status == "" {
+		// Trailers-Only 响应的状态在响应头中
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("missing grpc-status in response, Content-Type: %s", resp.Header.Get("Content-Type"))
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc-status %q", status)
+	}
+	if code != 0 {
+		// grpc-message 使用百分号编码
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+		return messages, &GrpcError{Code: code, Message: message}
+	}
+	return messages, nil
+}
+
+// parseGrpcWebTrailer 解析gRPC-web的trailer帧, 内容与HTTP头的格式相同
+func parseGrpcWebTrailer(payload []byte, trailer http.Header) {
+	for _, line := range strings.Split(string(payload), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if ok {
+			trailer.Add(textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name)), strings.TrimSpace(value))
+		}
+	}
+}
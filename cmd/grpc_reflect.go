@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/LiZeC123/gmh/util"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LoadProtosets 读取 protoc --include_imports -o 生成的描述文件, 多个文件中的同名定义只保留第一个
+func LoadProtosets(files []string) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read protoset: %w", err)
+		}
+		var fds descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &fds); err != nil {
+			return nil, fmt.Errorf("invalid protoset %s: %w", file, err)
+		}
+		for _, fd := range fds.File {
+			if !seen[fd.GetName()] {
+				seen[fd.GetName()] = true
+				set.File = append(set.File, fd)
+			}
+		}
+	}
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protoset: %w", err)
+	}
+	return registry, nil
+}
+
+// 服务端反射的服务名, 优先使用v1, 不支持时使用v1alpha, 两者的消息格式相同
+const (
+	reflectionV1      = "grpc.reflection.v1.ServerReflection"
+	reflectionV1Alpha = "grpc.reflection.v1alpha.ServerReflection"
+)
+
+// ReflectionClient 通过 grpc.reflection 服务获取服务定义
+// 反射是双向流接口, 这里每次发送一组请求后结束请求流, 再读取全部响应
+type ReflectionClient struct {
+	Client  *http.Client
+	BaseURL string
+	Web     bool
+	Header  http.Header
+	Timeout time.Duration
+
+	service string
+}
+
+// reflectionResponse 是 ServerReflectionResponse 中用到的字段
+type reflectionResponse struct {
+	files    [][]byte
+	services []string
+	err      *GrpcError
+}
+
+// call 发送一组 ServerReflectionRequest 并按顺序返回响应
+func (r *ReflectionClient) call(ctx context.Context, requests ...[]byte) ([]reflectionResponse, error) {
+	if r.service == "" {
+		r.service = reflectionV1
+	}
+	request := NewGrpcRequest(r.BaseURL+"/"+r.service+"/ServerReflectionInfo", r.Web, r.Header, r.Timeout, requests...)
+	req, err := request.Build()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer util.CloseWithLog(resp.Body)
+
+	messages, err := ReadGrpcResponse(resp, r.Web)
+	var grpcErr *GrpcError
+	if errors.As(err, &grpcErr) && grpcErr.Code == grpcUnimplemented && r.service == reflectionV1 {
+		r.service = reflectionV1Alpha
+		return r.call(ctx, requests...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("server reflection failed: %w", err)
+	}
+
+	responses := make([]reflectionResponse, 0, len(messages))
+	for _, msg := range messages {
+		parsed, err := parseReflectionResponse(msg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server reflection response: %w", err)
+		}
+		responses = append(responses, parsed)
+	}
+	if len(responses) != len(requests) {
+		return nil, fmt.Errorf("server reflection returned %d responses for %d requests", len(responses), len(requests))
+	}
+	return responses, nil
+}
+
+// ListServices 返回服务端注册的全部服务名
+func (r *ReflectionClient) ListServices(ctx context.Context) ([]string, error) {
+	responses, err := r.call(ctx, reflectionRequest(7, ""))
+	if err != nil {
+		return nil, err
+	}
+	if e := responses[0].err; e != nil {
+		return nil, fmt.Errorf("list services: %w", e)
+	}
+	return responses[0].services, nil
+}
+
+// Files 获取定义了symbols的文件及其全部依赖
+// 服务端不一定返回依赖的文件, 缺少的文件按文件名继续请求
+func (r *ReflectionClient) Files(ctx context.Context, symbols []string) (*protoregistry.Files, error) {
+	fds := map[string]*descriptorpb.FileDescriptorProto{}
+	add := func(responses []reflectionResponse, names []string) error {
+		for i, resp := range responses {
+			if resp.err != nil {
+				return fmt.Errorf("server reflection for %s: %w", names[i], resp.err)
+			}
+			for _, data := range resp.files {
+				fd := &descriptorpb.FileDescriptorProto{}
+				if err := proto.Unmarshal(data, fd); err != nil {
+					return fmt.Errorf("invalid file descriptor: %w", err)
+				}
+				fds[fd.GetName()] = fd
+			}
+		}
+		return nil
+	}
+
+	requests := make([][]byte, len(symbols))
+	for i, symbol := range symbols {
+		requests[i] = reflectionRequest(4, symbol)
+	}
+	responses, err := r.call(ctx, requests...)
+	if err != nil {
+		return nil, err
+	}
+	if err := add(responses, symbols); err != nil {
+		return nil, err
+	}
+
+	for {
+		var missing []string
+		for _, fd := range fds {
+			for _, dep := range fd.Dependency {
+				if fds[dep] == nil && !slices.Contains(missing, dep) {
+					missing = append(missing, dep)
+				}
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		requests = requests[:0]
+		for _, name := range missing {
+			requests = append(requests, reflectionRequest(3, name))
+		}
+		responses, err := r.call(ctx, requests...)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(responses, missing); err != nil {
+			return nil, err
+		}
+		for _, name := range missing {
+			if fds[name] == nil {
+				return nil, fmt.Errorf("server reflection did not return %s", name)
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range fds {
+		set.File = append(set.File, fd)
+	}
+	return protodesc.NewFiles(set)
+}
+
+// reflectionRequest 编码 ServerReflectionRequest, field 为 file_by_filename(3),
+// file_containing_symbol(4) 或 list_services(7)
+func reflectionRequest(field protowire.Number, value string) []byte {
+	b := protowire.AppendTag(nil, field, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// parseReflectionResponse 解码 ServerReflectionResponse 中的
+// file_descriptor_response(4), list_services_response(6) 和 error_response(7)
+func parseReflectionResponse(b []byte) (r reflectionResponse, err error) {
+	err = scanProtoFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 4:
+			return scanProtoFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+				if num == 1 {
+					r.files = append(r.files, v)
+				}
+				return nil
+			})
+		case 6:
+			return scanProtoFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+				if num != 1 {
+					return nil
+				}
+				return scanProtoFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+					if num == 1 {
+						r.services = append(r.services, string(v))
+					}
+					return nil
+				})
+			})
+		case 7:
+			r.err = &GrpcError{}
+			return scanProtoFields(v, func(num protowire.Number, v []byte, x uint64) error {
+				switch num {
+				case 1:
+					r.err.Code = int(int32(x))
+				case 2:
+					r.err.Message = string(v)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return
+}
+
+// scanProtoFields 依次处理消息中的每个字段, 长度前缀类型的字段传入v, varint类型的字段传入x
+func scanProtoFields(b []byte, fn func(num protowire.Number, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindGrpcMethod 查找方法, 名称可以是 pkg.Service/Method 或 pkg.Service.Method
+func FindGrpcMethod(files *protoregistry.Files, name string) (protoreflect.MethodDescriptor, error) {
+	full := strings.ReplaceAll(strings.TrimPrefix(name, "/"), "/", ".")
+	d, err := files.FindDescriptorByName(protoreflect.FullName(full))
+	if err != nil {
+		return nil, fmt.Errorf("method %s not found", name)
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+	return md, nil
+}
+
+// grpcServiceOf 返回方法名中的服务部分
+func grpcServiceOf(method string) string {
+	full := strings.ReplaceAll(strings.TrimPrefix(method, "/"), "/", ".")
+	if i := strings.LastIndex(full, "."); i > 0 {
+		return full[:i]
+	}
+	return full
+}
+
+// PrintGrpcServices 按名称顺序输出服务和方法的签名
+func PrintGrpcServices(w io.Writer, files *protoregistry.Files, services []string) {
+	slices.Sort(services)
+	for _, name := range services {
+		d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			util.PrintToFile(w, "%s (definition not found)\n", name)
+			continue
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			continue
+		}
+		util.PrintToFile(w, "%s\n", sd.FullName())
+		methods := sd.Methods()
+		for i := range methods.Len() {
+			util.PrintToFile(w, "  %s\n", grpcMethodSignature(methods.Get(i)))
+		}
+	}
+}
+
+// grpcMethodSignature 返回proto格式的方法签名
+func grpcMethodSignature(md protoreflect.MethodDescriptor) string {
+	stream := func(ok bool) string {
+		if ok {
+			return "stream "
+		}
+		return ""
+	}
+	return fmt.Sprintf("rpc %s(%s%s) returns (%s%s)", md.Name(),
+		stream(md.IsStreamingClient()), md.Input().FullName(),
+		stream(md.IsStreamingServer()), md.Output().FullName())
+}
+
+// DescribeGrpcMethod 输出方法签名以及请求和响应消息的字段
+func DescribeGrpcMethod(w io.Writer, md protoreflect.MethodDescriptor) {
+	util.PrintToFile(w, "%s\n", grpcMethodSignature(md))
+	for _, msg := range []protoreflect.MessageDescriptor{md.Input(), md.Output()} {
+		util.PrintToFile(w, "\nmessage %s {\n", msg.FullName())
+		fields := msg.Fields()
+		for i := range fields.Len() {
+			fd := fields.Get(i)
+			util.PrintToFile(w, "  %s %s = %d;\n", protoFieldType(fd), fd.Name(), fd.Number())
+		}
+		util.PrintToFile(w, "}\n")
+	}
+}
+
+func protoFieldType(fd protoreflect.FieldDescriptor) string {
+	if fd.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", protoFieldType(fd.MapKey()), protoFieldType(fd.MapValue()))
+	}
+	name := fd.Kind().String()
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		name = string(fd.Message().FullName())
+	case protoreflect.EnumKind:
+		name = string(fd.Enum().FullName())
+	}
+	if fd.IsList() {
+		return "repeated " + name
+	}
+	return name
+}
@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// echoFile 是测试用的服务定义, 依赖 timestamp.proto 以覆盖按文件名补全依赖的流程
+//
+//	package test;
+//	message EchoRequest { string text = 1; google.protobuf.Timestamp at = 2; }
+//	service Echo { rpc Echo(EchoRequest) returns (EchoRequest); }
+func echoFile() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/echo.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("EchoRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("text"),
+				JsonName: proto.String("text"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}, {
+				Name:     proto.String("at"),
+				JsonName: proto.String("at"),
+				Number:   proto.Int32(2),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".google.protobuf.Timestamp"),
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Echo"),
+				InputType:  proto.String(".test.EchoRequest"),
+				OutputType: proto.String(".test.EchoRequest"),
+			}},
+		}},
+	}
+}
+
+func timestampFile() *descriptorpb.FileDescriptorProto {
+	return protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto)
+}
+
+// grpcTestServer 模拟只支持v1alpha反射的服务端, 同时支持gRPC和gRPC-web调用 test.Echo/Echo
+type grpcTestServer struct {
+	t        *testing.T
+	requests []string
+}
+
+func (s *grpcTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests = append(s.requests, r.URL.Path)
+	web := strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc-web")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.t.Errorf("read request: %v", err)
+		return
+	}
+	messages, err := splitGrpcFrames(body)
+	if err != nil {
+		s.t.Errorf("invalid request frames: %v", err)
+		return
+	}
+
+	var replies [][]byte
+	switch r.URL.Path {
+	case "/" + reflectionV1Alpha + "/ServerReflectionInfo":
+		for _, msg := range messages {
+			replies = append(replies, s.reflect(msg))
+		}
+	case "/test.Echo/Echo":
+		replies = messages
+	default:
+		// Trailers-Only 响应, 状态在响应头中
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "12")
+		w.Header().Set("Grpc-Message", "unknown service")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if web {
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		for _, reply := range replies {
+			_, _ = w.Write(grpcFrame(0, reply))
+		}
+		_, _ = w.Write(grpcFrame(0x80, []byte("grpc-status: 0\r\ngrpc-message: \r\n")))
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	for _, reply := range replies {
+		_, _ = w.Write(grpcFrame(0, reply))
+	}
+	w.Header().Set("Grpc-Status", "0")
+}
+
+// reflect 按请求中的字段返回服务列表或文件描述, 按符号查询时只返回定义该符号的文件
+func (s *grpcTestServer) reflect(req []byte) []byte {
+	var reply []byte
+	err := scanProtoFields(req, func(num protowire.Number, v []byte, _ uint64) error {
+		var file *descriptorpb.FileDescriptorProto
+		switch {
+		case num == 7:
+			service := protowire.AppendTag(nil, 1, protowire.BytesType)
+			service = protowire.AppendString(service, "test.Echo")
+			list := protowire.AppendTag(nil, 1, protowire.BytesType)
+			list = protowire.AppendBytes(list, service)
+			reply = protowire.AppendTag(reply, 6, protowire.BytesType)
+			reply = protowire.AppendBytes(reply, list)
+			return nil
+		case num == 4 && string(v) == "test.Echo":
+			file = echoFile()
+		case num == 3 && string(v) == "google/protobuf/timestamp.proto":
+			file = timestampFile()
+		default:
+			e := protowire.AppendTag(nil, 1, protowire.VarintType)
+			e = protowire.AppendVarint(e, 5)
+			e = protowire.AppendTag(e, 2, protowire.BytesType)
+			e = protowire.AppendString(e, "not found: "+string(v))
+			reply = protowire.AppendTag(reply, 7, protowire.BytesType)
+			reply = protowire.AppendBytes(reply, e)
+			return nil
+		}
+		data, err := proto.Marshal(file)
+		if err != nil {
+			return err
+		}
+		fd := protowire.AppendTag(nil, 1, protowire.BytesType)
+		fd = protowire.AppendBytes(fd, data)
+		reply = protowire.AppendTag(reply, 4, protowire.BytesType)
+		reply = protowire.AppendBytes(reply, fd)
+		return nil
+	})
+	if err != nil {
+		s.t.Errorf("invalid reflection request: %v", err)
+	}
+	return reply
+}
+
+func splitGrpcFrames(data []byte) ([][]byte, error) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(append(data, grpcFrame(0x80, []byte("grpc-status: 0"))...))),
+	}
+	return ReadGrpcResponse(resp, true)
+}
+
+func newGrpcTestServer(t *testing.T) (*grpcTestServer, *httptest.Server) {
+	handler := &grpcTestServer{t: t}
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return handler, server
+}
+
+func TestGrpcFrame(t *testing.T) {
+	frame := grpcFrame(0, []byte("abc"))
+	if want := []byte{0, 0, 0, 0, 3, 'a', 'b', 'c'}; !bytes.Equal(frame, want) {
+		t.Fatalf("grpcFrame = %v, want %v", frame, want)
+	}
+
+	request := NewGrpcRequest("https://example.com/a.B/C", false, nil, 1500*time.Millisecond, []byte("x"), nil)
+	if got := request.Header.Get("Grpc-Timeout"); got != "1500m" {
+		t.Errorf("Grpc-Timeout = %q", got)
+	}
+	if got := request.Header.Get("Content-Type"); got != "application/grpc" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	messages, err := splitGrpcFrames(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || string(messages[0]) != "x" || len(messages[1]) != 0 {
+		t.Errorf("messages = %q", messages)
+	}
+
+	if _, err := splitGrpcFrames(frame[:6]); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("truncated frame error = %v", err)
+	}
+}
+
+func TestReadGrpcResponseTrailer(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(grpcFrame(0, []byte("ok")))),
+		Trailer:    http.Header{"Grpc-Status": {"0"}},
+	}
+	messages, err := ReadGrpcResponse(resp, false)
+	if err != nil || len(messages) != 1 || string(messages[0]) != "ok" {
+		t.Fatalf("ReadGrpcResponse = %q, %v", messages, err)
+	}
+
+	// Trailers-Only 响应
+	resp = &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Grpc-Status": {"12"}, "Grpc-Message": {"no%20such%20method"}},
+		Body:       http.NoBody,
+	}
+	_, err = ReadGrpcResponse(resp, false)
+	var grpcErr *GrpcError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != grpcUnimplemented || grpcErr.Message != "no such method" {
+		t.Fatalf("trailers-only error = %v", err)
+	}
+}
+
+func TestReadGrpcWebResponse(t *testing.T) {
+	var body []byte
+	body = append(body, grpcFrame(0, []byte("partial"))...)
+	body = append(body, grpcFrame(0x80, []byte("grpc-status:5\r\nGRPC-MESSAGE: user%20not%20found\r\nx-extra: 1\r\n"))...)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}
+	messages, err := ReadGrpcResponse(resp, true)
+	if len(messages) != 1 || string(messages[0]) != "partial" {
+		t.Errorf("messages = %q", messages)
+	}
+	var grpcErr *GrpcError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != 5 || grpcErr.Message != "user not found" {
+		t.Fatalf("error = %v", err)
+	}
+	if got := grpcErr.Error(); got != "grpc status NOT_FOUND: user not found" {
+		t.Errorf("Error() = %q", got)
+	}
+
+	trailer := http.Header{}
+	parseGrpcWebTrailer([]byte("grpc-status: 0\r\nbad line\r\n"), trailer)
+	if len(trailer) != 1 || trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("trailer = %v", trailer)
+	}
+}
+
+func TestReflectionFallbackToV1Alpha(t *testing.T) {
+	handler, server := newGrpcTestServer(t)
+	reflection := &ReflectionClient{Client: server.Client(), BaseURL: server.URL, Timeout: 5 * time.Second}
+
+	services, err := reflection.ListServices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(services, []string{"test.Echo"}) {
+		t.Errorf("services = %v", services)
+	}
+	if reflection.service != reflectionV1Alpha {
+		t.Errorf("service = %s, want %s", reflection.service, reflectionV1Alpha)
+	}
+	wantPaths := []string{"/" + reflectionV1 + "/ServerReflectionInfo", "/" + reflectionV1Alpha + "/ServerReflectionInfo"}
+	if !slices.Equal(handler.requests, wantPaths) {
+		t.Errorf("requests = %v", handler.requests)
+	}
+
+	// 服务端只返回定义符号的文件, 依赖的文件需要再按文件名获取
+	files, err := reflection.Files(context.Background(), services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files.FindFileByPath("google/protobuf/timestamp.proto"); err != nil {
+		t.Errorf("dependency not loaded: %v", err)
+	}
+	md, err := FindGrpcMethod(files, "test.Echo/Echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := grpcMethodSignature(md); got != "rpc Echo(test.EchoRequest) returns (test.EchoRequest)" {
+		t.Errorf("signature = %q", got)
+	}
+
+	if _, err := reflection.Files(context.Background(), []string{"test.Missing"}); err == nil || !strings.Contains(err.Error(), "not found: test.Missing") {
+		t.Errorf("missing symbol error = %v", err)
+	}
+}
+
+func TestGrpcUnaryCall(t *testing.T) {
+	_, server := newGrpcTestServer(t)
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{timestampFile(), echoFile()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := FindGrpcMethod(files, "/test.Echo/Echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, web := range []bool{false, true} {
+		codec := &GrpcCodec{Method: md, Web: web, Types: dynamicpb.NewTypes(files)}
+		request := NewGrpcRequest(server.URL+"/test.Echo/Echo", web, nil, 5*time.Second)
+		request.Body, err = codec.Encode([]byte(`{"text": "hi", "at": "2024-01-02T03:04:05Z"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rst := DoCurl(context.Background(), request, CurlOptions{Timeout: 5, Transport: server.Client().Transport, Body: codec})
+		if rst.Err != nil {
+			t.Fatalf("web=%v: %v", web, rst.Err)
+		}
+		if want := `{"text":"hi","at":"2024-01-02T03:04:05Z"}`; rst.Data != want {
+			t.Errorf("web=%v: Data = %s, want %s", web, rst.Data, want)
+		}
+	}
+}
+
+func TestLoadProtosets(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, fds ...*descriptorpb.FileDescriptorProto) string {
+		data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: fds})
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	// 两个文件都包含 timestamp.proto, 重复的定义只保留一个
+	a := write("a.protoset", timestampFile())
+	b := write("b.protoset", timestampFile(), echoFile())
+
+	files, err := LoadProtosets([]string{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := files.NumFiles(); n != 2 {
+		t.Errorf("NumFiles = %d, want 2", n)
+	}
+	if _, err := FindGrpcMethod(files, "test.Echo.Echo"); err != nil {
+		t.Error(err)
+	}
+	if _, err := FindGrpcMethod(files, "test.EchoRequest"); err == nil || !strings.Contains(err.Error(), "is not a method") {
+		t.Errorf("non-method error = %v", err)
+	}
+
+	// 缺少依赖
+	if _, err := LoadProtosets([]string{write("c.protoset", echoFile())}); err == nil {
+		t.Error("expect error for missing dependency")
+	}
+	bad := filepath.Join(dir, "bad.protoset")
+	if err := os.WriteFile(bad, []byte("not a protoset"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProtosets([]string{bad}); err == nil || !strings.Contains(err.Error(), "invalid protoset") {
+		t.Errorf("invalid protoset error = %v", err)
+	}
+}
@@ -0,0 +1,430 @@
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LiZeC123/gmh/util"
+	"github.com/urfave/cli/v3"
+)
+
+func WSCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ws",
+		Usage: "Send and receive WebSocket messages, or check that endpoints accept the upgrade",
+		// 可重复的参数不按逗号拆分, 握手请求头和消息中可能包含逗号
+		DisableSliceFlagSeparator: true,
+		Arguments: []cli.Argument{
+			&cli.StringArgs{
+				Name: "url",
+				Min:  0,
+				Max:  -1,
+			},
+		},
+		Flags: append([]cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "header",
+				Aliases: []string{"H"},
+				Usage:   "Extra handshake header in 'Name: Value' form, can be repeated",
+			},
+			&cli.StringFlag{
+				Name:  "origin",
+				Usage: "Origin header sent in the handshake",
+			},
+			&cli.StringFlag{
+				Name:  "subprotocol",
+				Usage: "Requested subprotocols, e.g. 'graphql-ws' or 'v2,v1'",
+			},
+			&cli.StringSliceFlag{
+				Name:    "message",
+				Aliases: []string{"m"},
+				Usage:   "Message to send after connecting, can be repeated",
+			},
+			&cli.StringFlag{
+				Name:  "message-file",
+				Usage: "File with one message per line to send after connecting. Use '-' for stdin",
+			},
+			&cli.BoolFlag{
+				Name:  "binary",
+				Usage: "Send messages as binary frames instead of text frames",
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "Delay between sent messages",
+			},
+			&cli.DurationFlag{
+				Name:  "wait",
+				Value: time.Second,
+				Usage: "Time to keep receiving after the last message is sent. Without messages, receive until closed",
+			},
+			&cli.IntFlag{
+				Name:    "count",
+				Aliases: []string{"n"},
+				Usage:   "Close after receiving the number of messages",
+			},
+			&cli.DurationFlag{
+				Name:  "ping",
+				Usage: "Send a ping frame at the interval, e.g. 30s",
+			},
+			&cli.Uint16Flag{
+				Name:  "close-code",
+				Value: 1000,
+				Usage: "Status code sent in the close frame",
+			},
+			&cli.StringFlag{
+				Name:  "close-reason",
+				Usage: "Reason sent in the close frame",
+			},
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "Batch mode: only check that every URL accepts the WebSocket upgrade",
+			},
+			&cli.StringFlag{
+				Name:    "input",
+				Aliases: []string{"i"},
+				Usage:   "File with one URL per line for --check. Use '-' for stdin",
+			},
+			&cli.Uint16Flag{
+				Name:    "concurrency",
+				Aliases: []string{"c"},
+				Value:   10,
+				Usage:   "Number of concurrent handshakes for --check",
+			},
+			&cli.Uint8Flag{
+				Name:    "timeout",
+				Aliases: []string{"t"},
+				Value:   10,
+				Usage:   "Handshake timeout in seconds",
+			},
+		}, transportFlags()...),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			header := http.Header{}
+			for _, h := range c.StringSlice("header") {
+				name, value, err := ParseHeader(h)
+				if err != nil {
+					return err
+				}
+				header.Add(name, value)
+			}
+			if origin := c.String("origin"); origin != "" {
+				header.Set("Origin", origin)
+			}
+			if protocol := c.String("subprotocol"); protocol != "" {
+				header.Set("Sec-WebSocket-Protocol", protocol)
+			}
+
+			// WebSocket 只能通过HTTP/1.1升级
+			transportOptions, err := NewTransportOptionsFromFlags(c)
+			if err != nil {
+				return err
+			}
+			if p := transportOptions.Protocol; p != "" && p != "http1.1" {
+				return fmt.Errorf("WebSocket requires HTTP/1.1, got --proto %s", p)
+			}
+			transportOptions.Protocol = "http1.1"
+			transport, err := NewTransport(transportOptions)
+			if err != nil {
+				return err
+			}
+			defer transport.CloseIdleConnections()
+			timeout := time.Duration(c.Uint8("timeout")) * time.Second
+
+			if c.Bool("check") {
+				return checkWSEndpoints(ctx, c, transport, header, timeout)
+			}
+
+			urls := c.StringArgs("url")
+			if len(urls) != 1 {
+				return errors.New("exactly one url is required, use --check to test multiple endpoints")
+			}
+			conn, err := DialWS(ctx, transport, urls[0], header, timeout)
+			if err != nil {
+				return err
+			}
+			defer util.CloseWithLog(conn)
+			util.PrintErrorLog("Connected to %s (%s)\n", urls[0], describeWSHandshake(conn.Response))
+
+			session := &wsSession{
+				conn:   conn,
+				out:    os.Stdout,
+				count:  c.Int("count"),
+				done:   make(chan struct{}),
+				closed: make(chan struct{}),
+			}
+			return session.Run(ctx, c)
+		},
+	}
+}
+
+func describeWSHandshake(resp *http.Response) string {
+	desc := resp.Status
+	if p := resp.Header.Get("Sec-WebSocket-Protocol"); p != "" {
+		desc += ", subprotocol " + p
+	}
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); ext != "" {
+		desc += ", extensions " + ext
+	}
+	return desc
+}
+
+// wsSession 是一次交互式的WebSocket会话
+type wsSession struct {
+	conn  *WSConn
+	out   io.Writer
+	count int
+
+	mu       sync.Mutex
+	received int
+	// done 在收到足够的消息后关闭, closed 在读取结束(收到关闭帧或连接断开)后关闭
+	done     chan struct{}
+	doneOnce sync.Once
+	closed   chan struct{}
+	readErr  error
+	// closeCode 是服务端关闭帧中的状态码
+	closeCode uint16
+}
+
+// printFrame 输出带时间戳的帧, dir 为 '>' 表示发送, '<' 表示接收
+func (s *wsSession) printFrame(dir byte, op byte, data []byte) {
+	ts := time.Now().Format("15:04:05.000")
+	switch op {
+	case wsOpText:
+		util.PrintToFile(s.out, "%s %c %s\n", ts, dir, data)
+	case wsOpBinary:
+		preview := data[:min(len(data), 32)]
+		util.PrintToFile(s.out, "%s %c binary (%d bytes) %s\n", ts, dir, len(data), hex.EncodeToString(preview))
+	case wsOpClose:
+		code, reason := parseClosePayload(data)
+		util.PrintToFile(s.out, "%s %c close %d %s\n", ts, dir, code, reason)
+	default:
+		util.PrintToFile(s.out, "%s %c %s %s\n", ts, dir, wsOpNames[op], data)
+	}
+}
+
+// readLoop 读取并输出服务端的消息, 自动回复ping和close
+func (s *wsSession) readLoop() {
+	defer close(s.closed)
+	for {
+		op, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.readErr = err
+			return
+		}
+		s.printFrame('<', op, data)
+
+		switch op {
+		case wsOpPing:
+			if err := s.conn.WriteMessage(wsOpPong, data); err == nil {
+				s.printFrame('>', wsOpPong, data)
+			}
+		case wsOpClose:
+			// 回复相同的状态码后等待服务端关闭连接
+			s.closeCode, _ = parseClosePayload(data)
+			_ = s.conn.WriteMessage(wsOpClose, data[:min(len(data), 2)])
+			return
+		case wsOpText, wsOpBinary:
+			s.mu.Lock()
+			s.received++
+			if s.count > 0 && s.received >= s.count {
+				s.doneOnce.Do(func() { close(s.done) })
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *wsSession) Run(ctx context.Context, c *cli.Command) error {
+	go s.readLoop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	stop := make(chan struct{})
+	stopOnce := sync.Once{}
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+		case <-s.done:
+		case <-s.closed:
+		}
+		stopOnce.Do(func() { close(stop) })
+	}()
+
+	if interval := c.Duration("ping"); interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := s.conn.WriteMessage(wsOpPing, nil); err != nil {
+						return
+					}
+					s.printFrame('>', wsOpPing, nil)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	// 发送消息
+	op := byte(wsOpText)
+	if c.Bool("binary") {
+		op = wsOpBinary
+	}
+	sent := 0
+	send := func(msg string) error {
+		if sent > 0 && c.Duration("interval") > 0 {
+			select {
+			case <-time.After(c.Duration("interval")):
+			case <-stop:
+				return context.Canceled
+			}
+		}
+		if op == wsOpText && !utf8.ValidString(msg) {
+			return fmt.Errorf("text message is not valid UTF-8, use --binary")
+		}
+		if err := s.conn.WriteMessage(op, []byte(msg)); err != nil {
+			return err
+		}
+		s.printFrame('>', op, []byte(msg))
+		sent++
+		return nil
+	}
+	err := func() error {
+		for _, msg := range c.StringSlice("message") {
+			if err := send(msg); err != nil {
+				return err
+			}
+		}
+		if file := c.String("message-file"); file != "" {
+			for line, err := range util.StreamFileInput(file) {
+				if err != nil {
+					return err
+				}
+				if err := send(line); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	// 发送完成后继续接收一段时间, 没有发送消息时一直接收
+	if sent > 0 {
+		select {
+		case <-time.After(c.Duration("wait")):
+		case <-stop:
+		}
+	} else {
+		<-stop
+	}
+
+	// 主动关闭时发送关闭帧并等待服务端回复
+	select {
+	case <-s.closed:
+	default:
+		code, reason := c.Uint16("close-code"), c.String("close-reason")
+		if err := s.conn.WriteClose(code, reason); err == nil {
+			s.printFrame('>', wsOpClose, append([]byte{byte(code >> 8), byte(code)}, reason...))
+		}
+		select {
+		case <-s.closed:
+		case <-time.After(time.Second):
+		}
+	}
+
+	// 服务端没有回复关闭帧时直接断开连接
+	select {
+	case <-s.closed:
+	default:
+		return nil
+	}
+	if s.readErr != nil && !errors.Is(s.readErr, io.EOF) && s.closeCode == 0 {
+		return fmt.Errorf("connection lost: %w", s.readErr)
+	}
+	// 1005 表示关闭帧中没有状态码, 与1000一样视为正常关闭
+	if s.closeCode != 0 && s.closeCode != 1000 && s.closeCode != 1005 && s.closeCode != c.Uint16("close-code") {
+		return fmt.Errorf("closed by server with code %d", s.closeCode)
+	}
+	return nil
+}
+
+// checkWSEndpoints 并发检查多个端点能否完成WebSocket握手, 握手成功后立即正常关闭
+func checkWSEndpoints(ctx context.Context, c *cli.Command, transport http.RoundTripper, header http.Header, timeout time.Duration) error {
+	type checkRst struct {
+		url      string
+		status   string
+		duration time.Duration
+		err      error
+	}
+
+	results := make(chan checkRst)
+	sem := make(chan struct{}, max(c.Uint16("concurrency"), 1))
+	var wg sync.WaitGroup
+	var inputErr error
+	go func() {
+		defer close(results)
+		for rawURL, err := range util.StreamAllInput(c, "url", "input") {
+			if err != nil {
+				inputErr = err
+				break
+			}
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				start := time.Now()
+				conn, err := DialWS(ctx, transport, rawURL, header, timeout)
+				rst := checkRst{url: rawURL, duration: time.Since(start), err: err}
+				if err == nil {
+					rst.status = describeWSHandshake(conn.Response)
+					_ = conn.WriteClose(1000, "")
+					util.CloseWithLog(conn)
+				}
+				results <- rst
+			}()
+		}
+		wg.Wait()
+	}()
+
+	total, fail := 0, 0
+	for rst := range results {
+		total++
+		if rst.err != nil {
+			fail++
+			fmt.Printf("FAIL %s %v (%v)\n", rst.url, rst.err, rst.duration.Round(time.Millisecond))
+		} else {
+			fmt.Printf("OK   %s %s (%v)\n", rst.url, rst.status, rst.duration.Round(time.Millisecond))
+		}
+	}
+	if inputErr != nil {
+		return inputErr
+	}
+	if total == 0 {
+		return errors.New("no URLs provided. Use command arguments or --input")
+	}
+	util.PrintErrorLog("Checked %d endpoints: Succ: %d Fail: %d\n", total, total-fail, fail)
+	if fail > 0 {
+		return fmt.Errorf("%d of %d endpoints failed the WebSocket upgrade", fail, total)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket 帧的操作码, 参考 RFC 6455
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsAcceptGUID 用于计算握手响应中的 Sec-WebSocket-Accept
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessageSize 是单个消息的最大长度, 防止异常数据耗尽内存
+const wsMaxMessageSize = 64 << 20
+
+var wsOpNames = map[byte]string{
+	wsOpContinuation: "continuation",
+	wsOpText:         "text",
+	wsOpBinary:       "binary",
+	wsOpClose:        "close",
+	wsOpPing:         "ping",
+	wsOpPong:         "pong",
+}
+
+// WSConn 是客户端一侧的WebSocket连接, 写操作可以并发调用, 读操作只能在一个goroutine中调用
+type WSConn struct {
+	rw  io.ReadWriteCloser
+	br  *bufio.Reader
+	wmu sync.Mutex
+	// msgOp 和 msgBuf 是未完成的分片消息, 读取控制帧返回后下次继续拼接
+	msgOp  byte
+	msgBuf []byte
+	// Response 是握手的响应
+	Response *http.Response
+}
+
+// DialWS 通过HTTP Upgrade建立WebSocket连接, 使用transport以支持代理和TLS配置
+// transport需要使用HTTP/1.1, ws和wss分别按http和https处理
+func DialWS(ctx context.Context, transport http.RoundTripper, rawURL string, header http.Header, timeout time.Duration) (*WSConn, error) {
+	switch {
+	case strings.HasPrefix(rawURL, "ws://"):
+		rawURL = "http://" + rawURL[len("ws://"):]
+	case strings.HasPrefix(rawURL, "wss://"):
+		rawURL = "https://" + rawURL[len("wss://"):]
+	}
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+
+	keyBytes := make([]byte, 16)
+	_, _ = rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	// 超时只作用于握手, 连接建立后不能取消请求的context
+	ctx, cancel := context.WithCancel(ctx)
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, cancel)
+	}
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if timer != nil && !timer.Stop() {
+		cancel()
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_ = resp.Body.Close()
+		cancel()
+		if detail := strings.TrimSpace(string(body)); detail != "" {
+			return nil, fmt.Errorf("upgrade failed: %s: %s", resp.Status, detail)
+		}
+		return nil, fmt.Errorf("upgrade failed: %s", resp.Status)
+	}
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		_ = resp.Body.Close()
+		cancel()
+		return nil, errors.New("upgrade failed: invalid Sec-WebSocket-Accept")
+	}
+	rw, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		cancel()
+		return nil, errors.New("upgrade failed: connection is not writable")
+	}
+
+	return &WSConn{rw: &wsCancelCloser{rw, cancel}, br: bufio.NewReader(rw), Response: resp}, nil
+}
+
+// wsCancelCloser 在关闭连接时释放握手请求的context
+type wsCancelCloser struct {
+	io.ReadWriteCloser
+	cancel context.CancelFunc
+}
+
+func (c *wsCancelCloser) Close() error {
+	defer c.cancel()
+	return c.ReadWriteCloser.Close()
+}
+
+// WriteMessage 发送一个不分片的帧, 客户端发送的帧需要使用随机掩码
+func (c *WSConn) WriteMessage(op byte, payload []byte) error {
+	header := make([]byte, 0, 14)
+	header = append(header, 0x80|op)
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, 0x80|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 0x80|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	mask := make([]byte, 4)
+	_, _ = rand.Read(mask)
+	header = append(header, mask...)
+
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.rw.Write(append(header, masked...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteClose 发送关闭帧, code为0时不携带状态码
+func (c *WSConn) WriteClose(code uint16, reason string) error {
+	var payload []byte
+	if code != 0 {
+		payload = binary.BigEndian.AppendUint16(nil, code)
+		payload = append(payload, reason...)
+	}
+	return c.WriteMessage(wsOpClose, payload)
+}
+
+// readFrame 读取一个帧, 服务端发送的帧不应使用掩码, 使用时也能正确解码
+func (c *WSConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.br, head[:]); err != nil {
+		return
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0F
+	masked := head[1]&0x80 != 0
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessageSize {
+		err = fmt.Errorf("frame too large: %d bytes", n)
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// ReadMessage 读取一个完整的消息, 合并分片的数据帧, 控制帧会穿插在分片之间单独返回
+func (c *WSConn) ReadMessage() (op byte, data []byte, err error) {
+	for {
+		fin, frameOp, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case frameOp >= wsOpClose:
+			return frameOp, payload, nil
+		case frameOp == wsOpContinuation:
+			if c.msgOp == 0 {
+				return 0, nil, errors.New("unexpected continuation frame")
+			}
+		default:
+			if c.msgOp != 0 {
+				return 0, nil, errors.New("new data frame before the previous message finished")
+			}
+			c.msgOp, c.msgBuf = frameOp, nil
+		}
+		if len(c.msgBuf)+len(payload) > wsMaxMessageSize {
+			return 0, nil, fmt.Errorf("message too large")
+		}
+		c.msgBuf = append(c.msgBuf, payload...)
+		if fin {
+			op, data = c.msgOp, c.msgBuf
+			c.msgOp, c.msgBuf = 0, nil
+			return op, data, nil
+		}
+	}
+}
+
+// Close 关闭底层连接
+func (c *WSConn) Close() error {
+	return c.rw.Close()
+}
+
+// parseClosePayload 解析关闭帧中的状态码和原因, 没有状态码时返回1005
+func parseClosePayload(payload []byte) (code uint16, reason string) {
+	if len(payload) < 2 {
+		return 1005, ""
+	}
+	return binary.BigEndian.Uint16(payload), string(payload[2:])
+}
@@ -3,6 +3,10 @@ module github.com/LiZeC123/gmh
 go 1.24.2
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
 	github.com/urfave/cli/v3 v3.3.8
+	golang.org/x/text v0.26.0
+	google.golang.org/protobuf v1.36.10
 )
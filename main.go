@@ -16,6 +16,9 @@ func main() {
 		Commands: []*cli.Command{
 			cmd.ServerCommand(),
 			cmd.CurlCommand(),
+			cmd.BenchCommand(),
+			cmd.WSCommand(),
+			cmd.GrpcCommand(),
 			cmd.DNSCommand(),
 			cmd.TcpingCommand(),
 			cmd.UUIDCommand(),
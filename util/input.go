@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"iter"
 	"os"
 	"strings"
 
@@ -26,35 +27,70 @@ func GetAllInput(c *cli.Command, argsName, fileName string) (lines []string, err
 }
 
 func GetFileInput(filePath string) (lines []string, err error) {
-	var reader io.Reader
-
-	if filePath == "-" {
-		// 从标准输入读取
-		reader = os.Stdin
-	} else {
-		// 从文件读取
-		file, err := os.Open(filePath)
+	for line, err := range StreamFileInput(filePath) {
 		if err != nil {
-			return nil, fmt.Errorf("failed to open file: %w", err)
+			return nil, err
 		}
-		defer CloseWithLog(file)
-		reader = file
+		lines = append(lines, line)
 	}
+	return
+}
 
-	// 读取
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			lines = append(lines, line)
+// 单行输入的最大长度, 允许在一行中包含较大的JSON
+const maxLineSize = 16 * 1024 * 1024
+
+// StreamFileInput 逐行读取文件中的非空行, 不会将整个文件读入内存
+func StreamFileInput(filePath string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var reader io.Reader
+
+		if filePath == "-" {
+			// 从标准输入读取
+			reader = os.Stdin
+		} else {
+			// 从文件读取
+			file, err := os.Open(filePath)
+			if err != nil {
+				yield("", fmt.Errorf("failed to open file: %w", err))
+				return
+			}
+			defer CloseWithLog(file)
+			reader = file
+		}
+
+		// 读取
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(nil, maxLineSize)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !yield(line, nil) {
+				return
+			}
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading input: %w", err)
+		if err := scanner.Err(); err != nil {
+			yield("", fmt.Errorf("error reading input: %w", err))
+		}
 	}
+}
 
-	return
+// StreamAllInput 依次返回命令行参数和输入文件中的每一行, 文件内容按需读取
+func StreamAllInput(c *cli.Command, argsName, fileName string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for _, arg := range c.StringArgs(argsName) {
+			if !yield(arg, nil) {
+				return
+			}
+		}
+
+		if inputFile := c.String(fileName); inputFile != "" {
+			for line, err := range StreamFileInput(inputFile) {
+				if !yield(line, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
 }
 
 func GetArgsOrStdinInput(c *cli.Command, argsName string) (lines []string, err error) {